@@ -3,9 +3,14 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
 	"os"
+	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	inco "github.com/imnive-design/inco-go/internal/inco"
@@ -14,16 +19,70 @@ import (
 const usage = `inco — invisible constraints, invincible code.
 
 Usage:
-  inco gen [dir]           Scan source files and generate overlay
-  inco build [args]        Run gen + go build -overlay
-  inco test [args]         Run gen + go test -overlay
-  inco run [args]          Run gen + go run -overlay
+  inco gen [gen flags] [dir]
+                           Scan source files and generate overlay
+  inco build [gen flags] [args]
+                           Run gen + go build -overlay
+  inco test [gen flags] [args]
+                           Run gen + go test -overlay; a -coverprofile is
+                           rewritten as by inco cover
+  inco run [gen flags] [args]
+                           Run gen + go run -overlay
+  inco file <path> [--print | -o out.go]
+                           Instrument a single file; print the shadow by default
   inco audit [dir]         Contract coverage report
+  inco contracts [-o dir] [dir]
+                           Describe every package's contracts as JSON; with
+                           -o, write a contracts.json per package under dir
+  inco cover <profile> [-o out] [dir]
+                           Map a coverage profile written with the overlay
+                           back to the source files and lines, in place
+                           or into out
+  inco adopt [--yes] [--commit] [--only=kinds] [dir]
+                           Suggest and insert directives package by package
+  inco wrap <import-path> [-o out.go]
+                           Generate a contract-checking wrapper package
   inco release [--dry-run] [dir]       Copy guards into source tree
   inco release clean [dir] Remove released files and restore originals
   inco clean [dir]         Remove .inco_cache
+  inco daemon [dir]        Keep the engine warm and serve gen requests;
+                           gen/build/test/run without gen flags use it
+  inco daemon stop [dir]   Stop the daemon
 
-If [dir] is omitted, the current directory is used.
+If [dir] is omitted, the current directory is used. Gen flags:
+  --groups=g1,g2           Enable the listed contract groups (@inco[group]:),
+                           replacing "groups" in .inco.json
+  --exported-only          Instrument exported functions only, as with
+                           "exported_only" in .inco.json
+  --include <pattern>      Instrument only the matching packages, e.g.
+                           ./api/...; repeatable, replaces "include"
+  --exclude <pattern>      Skip the matching packages; repeatable,
+                           replaces "exclude"
+  --func <regexp>          Instrument only functions whose names ("F" or
+                           "T.M") match; repeatable, replaces "funcs"
+  --typecheck              Type-check new shadows before writing them, as
+                           with "typecheck" in .inco.json
+  --include-tests          Instrument _test.go files too, as with
+                           "include_tests" in .inco.json
+  --follow-symlinks        Walk symbolic links to directories, as with
+                           "follow_symlinks" in .inco.json
+  --trimpath               Name sources relative to .inco_cache in //line
+                           directives, as with "trim_path" in .inco.json
+  --workers=N              Process N files concurrently (default: all CPUs)
+  --verbose                Log each file handled and the run's totals
+  --keep-going             Skip files that fail, write the overlay of the
+                           others, then report every failure
+  --strict                 Fail on any warning, as with "strict" in
+                           .inco.json
+  --shared-cache=<dir|url>
+                           Fetch shadows from, and store them in, a cache
+                           shared between checkouts: a directory or an
+                           HTTP server (GET/PUT)
+  --allow-translators     Run the -dsl translator commands of .inco.json
+                           (or set INCO_ALLOW_TRANSLATORS=1)
+  --check[=build|vet]      After gen, run "go build" (or "go vet") on ./...
+                           with the overlay and fail on errors, mapped
+                           back to the directives that caused them
 `
 
 func main() {
@@ -36,18 +95,28 @@ func main() {
 
 	switch os.Args[1] {
 	case "gen":
-		runGen(getDir(2))
-	case "build":
-		runGen(".")
-		runGo("build", ".", os.Args[2:])
-	case "test":
-		runGen(".")
-		runGo("test", ".", os.Args[2:])
-	case "run":
-		runGen(".")
-		runGo("run", ".", os.Args[2:])
+		opts, args := parseGenOptions(os.Args[2:])
+		dir := "."
+		if len(args) > 0 {
+			dir = args[0]
+		}
+		runGen(dir, opts)
+	case "build", "test", "run":
+		opts, args := parseGenOptions(os.Args[2:])
+		runGen(".", opts)
+		runGo(os.Args[1], ".", args)
+	case "file":
+		runFile(os.Args[2:], os.Stdout)
 	case "audit":
 		runAudit(getDir(2)).PrintReport(os.Stdout)
+	case "contracts":
+		runContracts(os.Args[2:], os.Stdout)
+	case "cover":
+		runCover(os.Args[2:])
+	case "adopt":
+		runAdopt(os.Args[2:], os.Stdin, os.Stdout)
+	case "wrap":
+		runWrap(os.Args[2:], os.Stdout)
 	case "release":
 		if len(os.Args) > 2 && os.Args[2] == "clean" {
 			runReleaseClean(getDir(3))
@@ -67,9 +136,11 @@ func main() {
 				}
 			}
 			dir := getDir(dirIdx)
-			runGen(dir)
+			runGen(dir, genOptions{})
 			runRelease(dir, dryRun)
 		}
+	case "daemon":
+		runDaemon(os.Args[2:])
 	case "clean":
 		dir := getDir(2)
 		err := os.RemoveAll(filepath.Join(dir, ".inco_cache"))
@@ -104,21 +175,239 @@ func getDir(argIdx int) string {
 	return "."
 }
 
-func runGen(dir string) {
+// genOptions are the gen flags, which override .inco.json.
+type genOptions struct {
+	groups         []string // nil when --groups is absent, so .inco.json decides
+	exportedOnly   bool
+	typecheck      bool
+	includeTests   bool
+	followSymlinks bool
+	trimPath       bool
+	strict         bool
+	keepGoing      bool
+	translators    bool     // run the translator commands of .inco.json
+	verbose        bool     // log each file handled
+	check          string   // go subcommand run against the overlay by gen; "" when --check is absent
+	include        []string // nil when --include is absent
+	exclude        []string // nil when --exclude is absent
+	funcs          []string // nil when --func is absent
+	workers        int      // 0 when --workers is absent
+	sharedCache    string   // "" when --shared-cache is absent
+}
+
+// parseGenOptions removes the gen flags from args. --include, --exclude
+// and --func take their pattern as the next argument or after "=".
+func parseGenOptions(args []string) (opts genOptions, rest []string) {
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		name, v, hasValue := strings.Cut(a, "=")
+		if list := opts.patterns(name); list != nil {
+			if !hasValue {
+				_ = args // @inco: i+1 < len(args), -panic(fmt.Sprintf("%s requires a package pattern", a))
+				if !(i+1 < len(args)) {
+					panic(fmt.Sprintf("%s requires a package pattern", a))
+				}
+				i++
+				v = args[i]
+			}
+			*list = append(*list, v)
+			continue
+		}
+		if v, ok := strings.CutPrefix(a, "--groups="); ok {
+			opts.groups = strings.Split(v, ",")
+			continue
+		}
+		if v, ok := strings.CutPrefix(a, "--shared-cache="); ok {
+			opts.sharedCache = v
+			continue
+		}
+		if v, ok := strings.CutPrefix(a, "--workers="); ok {
+			n, err := strconv.Atoi(v)
+			_ = err // @inco: err == nil && n > 0, -panic(fmt.Sprintf("--workers: want a positive number, got %q", v))
+			if !(err == nil && n > 0) {
+				panic(fmt.Sprintf("--workers: want a positive number, got %q", v))
+			}
+			opts.workers = n
+			continue
+		}
+		if a == "--exported-only" {
+			opts.exportedOnly = true
+			continue
+		}
+		if a == "--verbose" {
+			opts.verbose = true
+			continue
+		}
+		if a == "--keep-going" {
+			opts.keepGoing = true
+			continue
+		}
+		if a == "--allow-translators" {
+			opts.translators = true
+			continue
+		}
+		if a == "--strict" {
+			opts.strict = true
+			continue
+		}
+		if a == "--typecheck" {
+			opts.typecheck = true
+			continue
+		}
+		if a == "--include-tests" {
+			opts.includeTests = true
+			continue
+		}
+		if a == "--follow-symlinks" {
+			opts.followSymlinks = true
+			continue
+		}
+		if a == "--trimpath" {
+			opts.trimPath = true
+			continue
+		}
+		if a == "--check" {
+			opts.check = inco.CheckBuild
+			continue
+		}
+		if v, ok := strings.CutPrefix(a, "--check="); ok {
+			_ = v // @inco: v == inco.CheckBuild || v == inco.CheckVet, -panic(fmt.Sprintf("--check: want build or vet, got %q", v))
+			if !(v == inco.CheckBuild || v == inco.CheckVet) {
+				panic(fmt.Sprintf("--check: want build or vet, got %q", v))
+			}
+			opts.check = v
+			continue
+		}
+		rest = append(rest, a)
+	}
+	return opts, rest
+}
+
+// daemonOK reports whether a daemon, which runs with .inco.json as is,
+// can generate for these options: no flag changes the configuration or
+// needs the engine afterwards.
+func (opts genOptions) daemonOK() bool {
+	return opts.groups == nil && !opts.exportedOnly && !opts.typecheck && !opts.includeTests && !opts.followSymlinks &&
+		!opts.trimPath && !opts.strict && !opts.keepGoing && opts.check == "" && opts.include == nil && opts.exclude == nil &&
+		opts.funcs == nil && opts.workers == 0 && opts.sharedCache == "" && !opts.translators
+}
+
+// patterns returns the pattern list set by the flag name, --include,
+// --exclude or --func, or nil for any other name.
+func (opts *genOptions) patterns(name string) *[]string {
+	switch name {
+	case "--include":
+		return &opts.include
+	case "--exclude":
+		return &opts.exclude
+	case "--func":
+		return &opts.funcs
+	}
+	return nil
+}
+
+// runGen generates the overlay for dir, applying opts over .inco.json.
+// Generation warnings are printed to stderr. With --check, the project is
+// then compiled against the overlay and its errors printed. Without gen
+// flags, a daemon running for dir generates the overlay instead.
+func runGen(dir string, opts genOptions) {
 	absDir, err := filepath.Abs(dir)
 	_ = err // @inco: err == nil, -panic(err)
 	if !(err == nil) {
 		panic(err)
 	}
+	if opts.daemonOK() && genViaDaemon(absDir) {
+		return
+	}
 //line /Users/hitomikirigiri/Desktop/imnive/inco/cmd/inco/main.inco.go:100
-	err = inco.NewEngine(absDir).Run()
+	e := inco.NewEngine(absDir)
+	if opts.groups != nil {
+		e.Config.Groups = opts.groups
+	}
+	if opts.exportedOnly {
+		e.Config.ExportedOnly = true
+	}
+	if opts.typecheck {
+		e.Config.Typecheck = true
+	}
+	if opts.includeTests {
+		e.Config.IncludeTests = true
+	}
+	if opts.followSymlinks {
+		e.Config.FollowSymlinks = true
+	}
+	if opts.trimPath {
+		e.Config.TrimPath = true
+	}
+	if opts.strict {
+		e.Config.Strict = true
+	}
+	if opts.include != nil {
+		e.Config.Include = opts.include
+	}
+	if opts.exclude != nil {
+		e.Config.Exclude = opts.exclude
+	}
+	if opts.funcs != nil {
+		e.Config.Funcs = opts.funcs
+	}
+	e.Workers = opts.workers
+	if opts.sharedCache != "" {
+		e.SharedCache, err = inco.OpenSharedCache(opts.sharedCache)
+		_ = err // @inco: err == nil, -panic(err)
+		if !(err == nil) {
+			panic(err)
+		}
+	}
+	e.ContinueOnError = opts.keepGoing
+	e.RunTranslators = opts.translators
+	level := slog.LevelWarn
+	if opts.verbose {
+		level = slog.LevelDebug
+	}
+	// Run's error is printed by guardPanic; its Error records would repeat it.
+	e.Logger = newCLILogger(os.Stderr, level, true)
+	// Ctrl-C stops the run, leaving the previous overlay in place.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	report, err := e.RunReport(ctx)
+	printSummary(e.OverlayPath(), report)
+	// With --keep-going the overlay of the other files is written even
+	// when some failed; the failures are still fatal.
 	_ = err // @inco: err == nil, -panic(err)
 	if !(err == nil) {
 		panic(err)
 	}
+	if opts.check != "" {
+		diags, err := e.Check(ctx, opts.check)
+		_ = err // @inco: err == nil, -panic(err)
+		if !(err == nil) {
+			panic(err)
+		}
+		for _, d := range diags {
+			fmt.Fprintln(os.Stderr, d)
+		}
+		_ = diags // @inco: len(diags) == 0, -panic(fmt.Sprintf("check: go %s failed with the overlay", opts.check))
+		if !(len(diags) == 0) {
+			panic(fmt.Sprintf("check: go %s failed with the overlay", opts.check))
+		}
+	}
 //line /Users/hitomikirigiri/Desktop/imnive/inco/cmd/inco/main.inco.go:102
 }
 
+// printSummary prints the summary line of a run that wrote overlay.
+func printSummary(overlay string, report inco.Report) {
+	if report.Mapped == 0 {
+		return
+	}
+	shared := ""
+	if report.Shared > 0 {
+		shared = fmt.Sprintf(", %d from the shared cache", report.Shared)
+	}
+	fmt.Fprintf(os.Stderr, "inco: overlay written to %s (%d file(s) mapped, %d processed%s, %d cached)\n",
+		overlay, report.Mapped, report.Processed, shared, report.Cached)
+}
+
 func runAudit(dir string) *inco.AuditResult {
 	absDir, err := filepath.Abs(dir)
 	_ = err // @inco: err == nil, -panic(err)
@@ -142,7 +431,7 @@ func runRelease(dir string, dryRun bool) {
 		panic(err)
 	}
 //line /Users/hitomikirigiri/Desktop/imnive/inco/cmd/inco/main.inco.go:115
-	err = inco.Release(absDir, dryRun)
+	err = inco.Release(absDir, dryRun, newCLILogger(os.Stderr, slog.LevelInfo, true))
 	_ = err // @inco: err == nil, -panic(err)
 	if !(err == nil) {
 		panic(err)
@@ -157,7 +446,7 @@ func runReleaseClean(dir string) {
 		panic(err)
 	}
 //line /Users/hitomikirigiri/Desktop/imnive/inco/cmd/inco/main.inco.go:122
-	err = inco.ReleaseClean(absDir)
+	err = inco.ReleaseClean(absDir, newCLILogger(os.Stderr, slog.LevelInfo, true))
 	_ = err // @inco: err == nil, -panic(err)
 	if !(err == nil) {
 		panic(err)
@@ -178,15 +467,37 @@ func runGo(subcmd, dir string, extraArgs []string) {
 	}
 //line /Users/hitomikirigiri/Desktop/imnive/inco/cmd/inco/main.inco.go:134
 	args := append([]string{fmt.Sprintf("-overlay=%s", absOverlay)}, extraArgs...)
-	execGo(subcmd, args)
+	profile := ""
+	if subcmd == "test" {
+		profile = coverProfileArg(extraArgs)
+	}
+	if profile == "" {
+		execGo(subcmd, args)
+		return
+	}
+	// The profile names the shadows: map it back to the sources, failing
+	// tests or not.
+	err = goCmd(subcmd, args).Run()
+	if _, statErr := os.Stat(profile); statErr == nil {
+		rewriteCoverProfile(dir, profile, profile)
+	}
+	if err != nil {
+		os.Exit(1)
+	}
 }
 
 func execGo(subcmd string, args []string) {
+	if err := goCmd(subcmd, args).Run(); err != nil {
+		os.Exit(1)
+	}
+}
+
+// goCmd returns the go command running subcmd with args, attached to the
+// standard streams.
+func goCmd(subcmd string, args []string) *exec.Cmd {
 	cmd := execCommand("go", append([]string{subcmd}, args...)...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	cmd.Stdin = os.Stdin
-	if err := cmd.Run(); err != nil {
-		os.Exit(1)
-	}
+	return cmd
 }
@@ -0,0 +1,31 @@
+package inco
+
+import (
+	"expvar"
+	"testing"
+)
+
+func TestCount(t *testing.T) {
+	Count("test_count")
+	Count("test_count")
+	if got := Violations.Get("test_count").(*expvar.Int).Value(); got != 2 {
+		t.Errorf("count = %d, want 2", got)
+	}
+}
+
+type mapCounter map[string]int64
+
+func (m mapCounter) Add(name string, delta int64) { m[name] += delta }
+
+func TestSetCounter(t *testing.T) {
+	m := mapCounter{}
+	SetCounter(m)
+	defer SetCounter(nil)
+	Count("custom")
+	if m["custom"] != 1 {
+		t.Errorf("custom counter = %v", m)
+	}
+	if Violations.Get("custom") != nil {
+		t.Error("default counter should not be used after SetCounter")
+	}
+}
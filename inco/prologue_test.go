@@ -0,0 +1,36 @@
+package inco
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPrologue_Fail(t *testing.T) {
+	fail := func(p *Prologue, i int) (r any) {
+		defer func() { r = recover() }()
+		p.Fail(i)
+		return nil
+	}
+	p := &Prologue{Func: "main.F", File: "main.go", Checks: []Check{
+		{Line: 4, Msg: "inco violation: x != nil (at main.go:4)"},
+		{Line: 5, Msg: "inco violation: n > 0 (at main.go:5)"},
+	}}
+	if got, want := fail(p, 1), "inco violation: n > 0 (at main.go:5)"; got != want {
+		t.Errorf("Fail(1) panicked with %v, want %q", got, want)
+	}
+	p = &Prologue{Func: "main.F", File: "main.go", Violation: true, Stack: true, Checks: []Check{
+		{Kind: KindRequire, Line: 4, Expr: "x != nil"},
+		{Kind: KindRequire, Line: 5, Expr: "n > 0"},
+	}}
+	r := fail(p, 0)
+	v, ok := r.(*Violation)
+	if !ok {
+		t.Fatalf("Fail(0) panicked with %v, want a *Violation", r)
+	}
+	if v.Func != "main.F" || v.Expr != "x != nil" || v.Line != 4 || !errors.Is(v, ErrViolation) {
+		t.Errorf("Fail(0) = %+v", v)
+	}
+	if len(v.Stack) == 0 {
+		t.Error("Stack not recorded")
+	}
+}
@@ -0,0 +1,21 @@
+package inco
+
+import "testing"
+
+func TestSample(t *testing.T) {
+	if Sample(0) {
+		t.Error("Sample(0) = true")
+	}
+	if !Sample(1) {
+		t.Error("Sample(1) = false")
+	}
+	n := 0
+	for i := 0; i < 10000; i++ {
+		if Sample(0.5) {
+			n++
+		}
+	}
+	if n < 4000 || n > 6000 {
+		t.Errorf("Sample(0.5) hit %d of 10000", n)
+	}
+}
@@ -0,0 +1,70 @@
+package inco
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestViolation_Error(t *testing.T) {
+	v := NewViolation(KindRequire, "main.F", "x > 0", "main.go", 7, nil)
+	if got, want := v.Error(), "inco violation: x > 0 (at main.go:7)"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	v = NewViolation(KindMust, "main.F", "err == nil", "main.go", 9, io.EOF)
+	if got, want := v.Error(), "inco violation: err == nil (at main.go:9): EOF"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
+
+func TestViolation_IsAs(t *testing.T) {
+	var err error = NewViolation(KindMust, "main.F", "err == nil", "main.go", 9, io.EOF)
+	if !errors.Is(err, ErrViolation) {
+		t.Error("errors.Is(v, ErrViolation) = false")
+	}
+	if !errors.Is(err, io.EOF) {
+		t.Error("errors.Is(v, io.EOF) = false; checked error should unwrap")
+	}
+	var v *Violation
+	if !errors.As(err, &v) || v.Kind != KindMust || v.Func != "main.F" || v.Line != 9 {
+		t.Errorf("errors.As = %+v", v)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	f := func() (err error) {
+		defer Recover(&err)
+		panic(NewViolation(KindRequire, "", "p != nil", "a.go", 3, nil))
+	}
+	if err := f(); !errors.Is(err, ErrViolation) {
+		t.Errorf("Recover: got %v", err)
+	}
+
+	wrapped := func() (err error) {
+		defer Recover(&err)
+		panic(fmt.Errorf("handler: %w", NewViolation(KindMust, "main.G", "ok", "b.go", 4, nil)))
+	}
+	var v *Violation
+	if err := wrapped(); !errors.As(err, &v) || err != error(v) || v.Func != "main.G" {
+		t.Errorf("Recover should unwrap to the violation, got %#v", err)
+	}
+
+	defer func() {
+		if r := recover(); r != "boom" {
+			t.Errorf("foreign panic should propagate, got %v", r)
+		}
+	}()
+	func() (err error) {
+		defer Recover(&err)
+		panic("boom")
+	}()
+}
+
+func TestViolation_WithStack(t *testing.T) {
+	v := NewViolation(KindRequire, "main.F", "x > 0", "main.go", 7, nil).WithStack()
+	if !strings.Contains(string(v.Stack), "TestViolation_WithStack") {
+		t.Errorf("stack does not include the caller:\n%s", v.Stack)
+	}
+}
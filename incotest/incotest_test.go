@@ -0,0 +1,68 @@
+package incotest
+
+import (
+	"strings"
+	"testing"
+)
+
+const contractSrc = `package demo
+
+// Div divides a by b.
+func Div(a, b int) int {
+	// @inco: b != 0, -panic("division by zero")
+	return a / b
+}
+`
+
+const contractTest = `package demo
+
+import "testing"
+
+func TestDivContract(t *testing.T) {
+	defer func() {
+		if r := recover(); r != "division by zero" {
+			t.Fatalf("recover() = %v, want contract violation", r)
+		}
+	}()
+	Div(1, 0)
+}
+`
+
+func TestBuildAndRunWithOverlay(t *testing.T) {
+	dir := Module(t, "example.com/demo", map[string]string{
+		"demo.go":      contractSrc,
+		"demo_test.go": contractTest,
+	})
+	overlay := Build(t, dir)
+
+	// Without the overlay the guard is absent and the runtime error
+	// differs, so the test must fail.
+	if out, err := Go(dir, "", "test", "./..."); err == nil || !strings.Contains(out, "integer divide by zero") {
+		t.Fatalf("expected test to fail without contracts: %v\n%s", err, out)
+	}
+	if out, err := Go(dir, overlay, "test", "./..."); err != nil {
+		t.Fatalf("go test with overlay: %v\n%s", err, out)
+	}
+
+	t.Chdir(dir)
+	if out := RunWithOverlay(t); !strings.Contains(out, "ok") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+}
+
+func TestGateTag(t *testing.T) {
+	dir := Module(t, "example.com/demo", map[string]string{
+		".inco.json":   `{"gate_tag": "inco_off"}`,
+		"demo.go":      contractSrc,
+		"demo_test.go": contractTest,
+	})
+	overlay := Build(t, dir)
+
+	if out, err := Go(dir, overlay, "test", "./..."); err != nil {
+		t.Fatalf("go test with overlay: %v\n%s", err, out)
+	}
+	// The tag compiles the guard out without regenerating the overlay.
+	if out, err := Go(dir, overlay, "test", "-tags", "inco_off", "./..."); err == nil || !strings.Contains(out, "integer divide by zero") {
+		t.Fatalf("expected checks to be compiled out with -tags inco_off: %v\n%s", err, out)
+	}
+}
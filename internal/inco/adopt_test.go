@@ -0,0 +1,181 @@
+package inco
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const adoptSrc = `package svc
+
+type DB struct{}
+
+func (db *DB) Query(q string) (string, error) { return q, nil }
+
+func Load(db *DB, cfg *Config) string {
+	v, _ := db.Query("x")
+	return v
+}
+
+func Guarded(db *DB) {
+	// @inco: db != nil
+	_ = db
+}
+
+func internal(db *DB) {
+	_ = db
+}
+
+type Config struct{}
+`
+
+func TestSuggest_Candidates(t *testing.T) {
+	dir := setupDir(t, map[string]string{"svc/svc.go": adoptSrc})
+	sugs, err := Suggest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var nilParams, discarded int
+	for _, s := range sugs {
+		switch s.Kind {
+		case SuggestNilParam:
+			nilParams++
+			if s.Func != "Load" {
+				t.Errorf("unexpected nil-param suggestion in %s", s.Func)
+			}
+		case SuggestDiscardedError:
+			discarded++
+		}
+		if s.Pkg != "svc" {
+			t.Errorf("Pkg = %q, want svc", s.Pkg)
+		}
+	}
+	if nilParams != 2 {
+		t.Errorf("nil-param suggestions = %d, want 2 (db, cfg)", nilParams)
+	}
+	if discarded != 1 {
+		t.Errorf("discarded-error suggestions = %d, want 1", discarded)
+	}
+}
+
+func TestApplySuggestions(t *testing.T) {
+	dir := setupDir(t, map[string]string{"svc/svc.go": adoptSrc})
+	sugs, err := Suggest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := ApplySuggestions(sugs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("modified %d files, want 1", len(files))
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "svc", "svc.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(data)
+	want := "func Load(db *DB, cfg *Config) string {\n" +
+		"\t// @inco: db != nil\n" +
+		"\t// @inco: cfg != nil\n" +
+		"\tv, err := db.Query(\"x\")\n" +
+		"\t_ = err // @inco: err == nil, -panic(err)\n" +
+		"\treturn v\n"
+	if !strings.Contains(got, want) {
+		t.Errorf("applied source missing expected edits, got:\n%s", got)
+	}
+
+	// The edited file must still be processed cleanly by the engine.
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(readShadow(t, e), "if !(err == nil)") {
+		t.Error("adopted directive should generate a guard")
+	}
+}
+
+func TestApplySuggestions_Vet(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"go.mod":     "module example.com/m\n\ngo 1.22\n",
+		"svc/svc.go": adoptSrc,
+	})
+	sugs, err := Suggest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ApplySuggestions(sugs); err != nil {
+		t.Fatal(err)
+	}
+	// Adopted sources build without inco: the directives are comments.
+	cmd := exec.Command("go", "vet", "./...")
+	cmd.Dir = dir
+	if msg, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go vet on the adopted source: %v\n%s", err, msg)
+	}
+}
+
+func TestSuggest_DiscardedNonError(t *testing.T) {
+	dir := setupDir(t, map[string]string{"svc/svc.go": `package svc
+
+import (
+	"strconv"
+	"sync"
+)
+
+var cache sync.Map
+
+func lookup(k string) any {
+	v, _ := cache.Load(k)
+	return v
+}
+
+func count(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+func first(xs []int) int {
+	x, _ := pair(xs)
+	return x
+}
+
+func pair(xs []int) (int, bool) { return xs[0], true }
+`})
+	sugs, err := Suggest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var funcs []string
+	for _, s := range sugs {
+		if s.Kind == SuggestDiscardedError {
+			funcs = append(funcs, s.Func)
+		}
+	}
+	if len(funcs) != 1 || funcs[0] != "count" {
+		t.Errorf("discarded-error suggestions in %v, want only count: the others discard a bool", funcs)
+	}
+}
+
+func TestSuggest_SkipPragma(t *testing.T) {
+	dir := setupDir(t, map[string]string{"svc/svc.go": `package svc
+
+//inco:skip
+func Load(p *int) int {
+	v, _ := get()
+	return v + *p
+}
+
+func get() (int, error) { return 0, nil }
+`})
+	sugs, err := Suggest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sugs) != 0 {
+		t.Errorf("expected no suggestions in //inco:skip function, got %v", sugs)
+	}
+}
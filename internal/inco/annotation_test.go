@@ -0,0 +1,188 @@
+package inco
+
+import (
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseAnnotation(t *testing.T) {
+	tests := []struct {
+		in   string
+		want annotation
+		ok   bool
+	}{
+		{`// @deprecated "use V2"`, annotation{"deprecated", `"use V2"`, 3}, true},
+		{"// @deprecated", annotation{"deprecated", "", 3}, true},
+		{"/* @deprecated */", annotation{"deprecated", "", 3}, true},
+		{`// @timing 50ms, -metric("slow")`, annotation{"timing", `50ms, -metric("slow")`, 3}, true},
+		{"// @trace", annotation{"trace", "", 3}, true},
+		{"// @deprecatedX", annotation{}, false},
+		{"// @inco: x > 0", annotation{}, false},
+		{"// deprecated", annotation{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseAnnotation(tt.in, 3)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("parseAnnotation(%q) = %+v, %v; want %+v, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestEngine_Deprecated(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"main.go": `package main
+
+// NewClient connects to addr.
+//
+// @deprecated "use NewClientV2"
+func NewClient(addr string) string {
+	// @inco: addr != ""
+	return addr
+}
+
+func old() {
+	// @deprecated
+}
+
+//inco:disable
+// @deprecated
+func skipped() {
+}
+//inco:enable
+`,
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	shadow := readShadow(t, e)
+	for _, want := range []string{
+		"func NewClient(addr string) string {\n//line " + filepath.Join(dir, "main.go") + ":5\n\t_incoSite_",
+		`.Do(func() { log.Println("inco: main.NewClient is deprecated: use NewClientV2") })`,
+		`.Do(func() { log.Println("inco: main.old is deprecated") })`,
+		"func skipped() {\n}",
+		"\"sync\"",
+	} {
+		if !strings.Contains(shadow, want) {
+			t.Errorf("missing %q in:\n%s", want, shadow)
+		}
+	}
+	if strings.Index(shadow, "is deprecated") > strings.Index(shadow, "if !(addr") {
+		t.Errorf("warning should precede entry preconditions:\n%s", shadow)
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "shadow.go", shadow, 0); err != nil {
+		t.Fatalf("shadow does not parse: %v\n%s", err, shadow)
+	}
+
+	writeFile(t, filepath.Join(dir, "main.go"), "package main\n\n// @deprecated use V2\nfunc F() {\n}\n")
+	if err := NewEngine(dir).Run(); err == nil || !strings.Contains(err.Error(), "@deprecated takes a string literal") {
+		t.Errorf("expected string literal error, got %v", err)
+	}
+	writeFile(t, filepath.Join(dir, "main.go"), "package main\n\n// @deprecated\nfunc F() {}\n")
+	if err := NewEngine(dir).Run(); err == nil || !strings.Contains(err.Error(), "requires a multi-line function body") {
+		t.Errorf("expected multi-line body error, got %v", err)
+	}
+}
+
+func TestEngine_Timing(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"main.go": `package main
+
+// @timing 50ms
+func Slow() {
+}
+
+func Load() (err error) {
+	// @timing 1s, -metric("slow_loads")
+	return nil
+}
+
+func Save() (err error) {
+	// @timing 2m, -warn, -onsuccess
+	return nil
+}
+`,
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	shadow := readShadow(t, e)
+	for _, want := range []string{
+		"func Slow() {\n//line " + filepath.Join(dir, "main.go") + ":3\n\t_incoStart := time.Now()\n\tdefer func() {\n\t\tif !(time.Since(_incoStart) <= time.Duration(50000000)) {\n\t\t\tlog.Println(\"inco: main.Slow took \" + time.Since(_incoStart).String() + \", over 50ms\")",
+		"if !(time.Since(_incoStart) <= time.Duration(1000000000)) {\n\t\t\tinco.Count(\"slow_loads\")\n\t\t}",
+		"if err == nil && !(time.Since(_incoStart) <= time.Duration(120000000000)) {\n\t\t\tslog.Warn(",
+		`"expr", "main.Save within 2m"`,
+		`"time"`,
+	} {
+		if !strings.Contains(shadow, want) {
+			t.Errorf("missing %q in:\n%s", want, shadow)
+		}
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "shadow.go", shadow, 0); err != nil {
+		t.Fatalf("shadow does not parse: %v\n%s", err, shadow)
+	}
+
+	for src, msg := range map[string]string{
+		"// @timing fast\nfunc F() {\n}\n":              "@timing takes a positive duration",
+		"// @timing 1s, -return\nfunc F() {\n}\n":       "invalid @timing options",
+		"// @timing 1s\n// @timing 2s\nfunc F() {\n}\n": "duplicate @timing",
+		"func F() {\n\t// @timing 1s, -onerror\n}\n":    "-onerror requires a named error result",
+	} {
+		writeFile(t, filepath.Join(dir, "main.go"), "package main\n\n"+src)
+		if err := NewEngine(dir).Run(); err == nil || !strings.Contains(err.Error(), msg) {
+			t.Errorf("%q: expected %q error, got %v", src, msg, err)
+		}
+	}
+}
+
+func TestEngine_Trace(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"main.go": `package main
+
+import "context"
+
+// @timing 1s
+// @trace
+func Handle(ctx context.Context, id string) error {
+	// @inco: id != "", -return(nil)
+	return nil
+}
+
+func Plain(ctx context.Context, n int) {
+	// @inco: n > 0
+}
+`,
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	shadow := readShadow(t, e)
+	event := `trace.SpanFromContext(ctx).AddEvent("inco violation", trace.WithAttributes(`
+	for _, want := range []string{
+		"func Handle(ctx context.Context, id string) error {\n//line " + filepath.Join(dir, "main.go") + ":6\n\ttrace.SpanFromContext(ctx).AddEvent(\"main.Handle\")\n",
+		"\t\t\t" + event + `attribute.String("kind", "ensure")`,
+		"\t\t" + event + `attribute.String("kind", "require"), attribute.String("file", "main.go"), attribute.Int("line", 8), attribute.String("expr", "id != \"\"")))` + "\n\t\treturn nil",
+		`"go.opentelemetry.io/otel/trace"`,
+		`"go.opentelemetry.io/otel/attribute"`,
+	} {
+		if !strings.Contains(shadow, want) {
+			t.Errorf("missing %q in:\n%s", want, shadow)
+		}
+	}
+	if n := strings.Count(shadow, event); n != 2 {
+		t.Errorf("got %d violation events, want 2 (Plain is not traced):\n%s", n, shadow)
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "shadow.go", shadow, 0); err != nil {
+		t.Fatalf("shadow does not parse: %v\n%s", err, shadow)
+	}
+
+	writeFile(t, filepath.Join(dir, "main.go"), "package main\n\n// @trace\nfunc F(id string) {\n}\n")
+	if err := NewEngine(dir).Run(); err == nil || !strings.Contains(err.Error(), "@trace requires a context.Context first parameter") {
+		t.Errorf("expected context parameter error, got %v", err)
+	}
+}
@@ -69,7 +69,7 @@ func Audit(root string) (*AuditResult, error) {
 	var files []FileAudit
 	var ignored []string
 
-	walkGoFiles(absRoot, func(path string) error {
+	walkGoFiles(os.DirFS(absRoot), absRoot, pkgFilter{}, func(path string) error {
 		fa := auditFile(fset, absRoot, path)
 		files = append(files, fa)
 		return nil
@@ -160,13 +160,17 @@ func auditFile(fset *token.FileSet, root, path string) FileAudit {
 	}
 	var directives []directiveInfo
 
+	pragmas, _ := collectPragmas(f, fset)
 	for _, cg := range f.Comments {
 		for _, c := range cg.List {
-			d := ParseDirective(c.Text)
+			d := pragmas.parse(c.Text)
 			_ = d // @inco: d != nil, -continue
 			if !(d != nil) {
 				continue
 			}
+			if !pragmas.enabled(fset.Position(c.Pos()).Line) {
+				continue
+			}
 //line /Users/hitomikirigiri/Desktop/imnive/inco/internal/inco/audit.inco.go:141
 			fa.RequireCount++
 			directives = append(directives, directiveInfo{pos: c.Pos()})
@@ -0,0 +1,61 @@
+package inco
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestEngine_Check(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go toolchain not available")
+	}
+	dir := setupDir(t, map[string]string{
+		"go.mod": "module example.com/m\n\ngo 1.22\n",
+		// Standalone directive: the go command reports the error through
+		// the shadow's //line directive, one line past the directive.
+		"main.go": "package main\n\nfunc Count(n int) int {\n\t// @inco: n >= 0, -return(nil)\n\treturn n\n}\n\nfunc main() {}\n",
+		// Inline directive: the error is reported at the shadow itself.
+		"lib/lib.go": "package lib\n\nimport \"strconv\"\n\nfunc Atoi(s string) int {\n\tn, err := strconv.Atoi(s) // @inco: err == nil, -return(nil)\n\treturn n\n}\n",
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	diags, err := e.Check(context.Background(), CheckBuild)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{
+		filepath.Join(dir, "main.go"):       4,
+		filepath.Join(dir, "lib", "lib.go"): 6,
+	}
+	if len(diags) != len(want) {
+		t.Fatalf("diagnostics = %v, want one per directive", diags)
+	}
+	for _, d := range diags {
+		if want[d.Path] != d.Line {
+			t.Errorf("diagnostic %s, want %s at line %d", d, d.Path, want[d.Path])
+		}
+	}
+
+	for path, src := range map[string]string{
+		"main.go":    "package main\n\nfunc Count(n int) int {\n\t// @inco: n >= 0, -return(0)\n\treturn n\n}\n\nfunc main() {}\n",
+		"lib/lib.go": "package lib\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, path), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if diags, err := e.Check(context.Background(), CheckVet); err != nil || len(diags) != 0 {
+		t.Errorf("Check(vet) = %v, %v, want no diagnostics", diags, err)
+	}
+	if _, err := e.Check(context.Background(), "test"); err == nil {
+		t.Error("Check(test): want error for an unknown tool")
+	}
+}
@@ -0,0 +1,655 @@
+package inco
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfig_Missing(t *testing.T) {
+	cfg, err := LoadConfig(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cfg, Config{}) {
+		t.Errorf("missing .inco.json should yield zero Config, got %+v", cfg)
+	}
+}
+
+func TestLoadConfig_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, ".inco.json"), "{not json")
+	if _, err := LoadConfig(dir); err == nil {
+		t.Fatal("expected error for malformed .inco.json")
+	}
+	if err := NewEngine(dir).Run(); err == nil {
+		t.Fatal("Run should report the config error")
+	}
+}
+
+func TestEngine_LocationTable(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		".inco.json": `{"location_table": true}`,
+		"main.go": `package main
+
+func Get(a, b *int) {
+	// @inco: a != nil
+	// @inco: b != nil, -log
+	// @inco: *a > 0, -panic("custom")
+	_ = *a + *b
+}
+`,
+	})
+	e := NewEngine(dir)
+	if !e.Config.LocationTable {
+		t.Fatal("location_table should be loaded from .inco.json")
+	}
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	shadow := readShadow(t, e)
+	if strings.Contains(shadow, `(at main.go:4)"`) {
+		t.Errorf("location should not be embedded in the message literal, got:\n%s", shadow)
+	}
+	if !strings.Contains(shadow, `panic("inco violation: a != nil (at " + _incoLoc_`) {
+		t.Errorf("panic should reference the location table, got:\n%s", shadow)
+	}
+	if !strings.Contains(shadow, `[1] + ")")`) {
+		t.Errorf("second check should use index 1, got:\n%s", shadow)
+	}
+	if !strings.Contains(shadow, "\t\"main.go:4\",\n\t\"main.go:5\",\n}") {
+		t.Errorf("table should list only default-message locations, got:\n%s", shadow)
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "shadow.go", shadow, 0); err != nil {
+		t.Errorf("shadow does not parse: %v\n%s", err, shadow)
+	}
+}
+
+func TestEngine_GroupPrologue(t *testing.T) {
+	root, err := filepath.Abs("../..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum, err := os.ReadFile(filepath.Join(root, "go.sum"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := setupDir(t, map[string]string{
+		".inco.json": `{"group_prologue": true}`,
+		"go.mod":     "module example.com/m\n\ngo 1.25\n\nrequire github.com/imnive-design/inco-go v0.0.0\n\nreplace github.com/imnive-design/inco-go => " + root + "\n",
+		"go.sum":     string(sum),
+		"main.go": `package main
+
+import "fmt"
+
+func Transfer(from, to *int, name string) error {
+	// @inco: from != nil
+	// @inco: to != nil
+	// @inco: -match("^[a-z]+$") next(name)
+	// @inco: *from > 0, -return(nil)
+	*from -= 1
+	return nil
+}
+
+var calls int
+
+func next(s string) string { calls++; return s }
+
+func main() {
+	n := 1
+	Transfer(&n, &n, "ok")
+	fmt.Println(calls)
+	defer func() { fmt.Println(recover()) }()
+	Transfer(&n, nil, "ok")
+}
+`,
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	shadow := readShadow(t, e)
+	for _, want := range []string{
+		"\tif _incoFail := func() int {\n",
+		"\t\tif !(to != nil) {\n\t\t\treturn 1\n\t\t}\n",
+		"}(); _incoFail >= 0 {\n",
+		".Fail(_incoFail)\n",
+		`{Line: 7, Msg: "inco violation: to != nil (at main.go:7)"},`,
+		"\tif !(*from > 0) {\n\t\treturn nil\n",
+	} {
+		if !strings.Contains(shadow, want) {
+			t.Errorf("missing %q in:\n%s", want, shadow)
+		}
+	}
+	if n := strings.Count(shadow, "MatchString(next(name))"); n != 1 {
+		t.Errorf("the -match operand is evaluated %d times, want 1:\n%s", n, shadow)
+	}
+	cmd := exec.Command("go", "run", "-overlay", e.OverlayPath(), ".")
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("go run: %v\n%s\n%s", err, out, shadow)
+	}
+	if want := "1\ninco violation: to != nil (at main.go:7)\n"; string(out) != want {
+		t.Errorf("output = %q, want %q", out, want)
+	}
+}
+
+func TestGroupable(t *testing.T) {
+	tests := []struct {
+		comment string
+		want    bool
+	}{
+		{"// @inco: x != nil", true},
+		{"// @inco: ok(x)", true},
+		{`// @inco: -match("^[a-z]+$") s`, true},
+		{"// @inco: len(s) > 0, -return", false},
+		{"// @inco: x > 0, -log", false},
+		{`// @inco: x > 0, -panic("x")`, false},
+		{`// @inco: x > 0, -msgf("x = %d", x)`, false},
+		{"// @inco: err == nil", false},
+	}
+	for _, tt := range tests {
+		d := ParseDirective(tt.comment)
+		if d == nil {
+			t.Fatalf("ParseDirective(%q) = nil", tt.comment)
+		}
+		if got := groupable(d); got != tt.want {
+			t.Errorf("groupable(%q) = %v, want %v", tt.comment, got, tt.want)
+		}
+	}
+}
+
+func TestLoadConfig_Predicates(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, ".inco.json"), `{
+  "predicates": {
+    "validEmail": {"expr": "mail.IsEmail(%s)", "import": "example.com/app/mail"},
+    "positive": "%s > 0"
+  }
+}`)
+	cfg, err := LoadConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]Predicate{
+		"validEmail": {Expr: "mail.IsEmail(%s)", Import: "example.com/app/mail"},
+		"positive":   {Expr: "%s > 0"},
+	}
+	if !reflect.DeepEqual(cfg.Predicates, want) {
+		t.Errorf("Predicates = %+v, want %+v", cfg.Predicates, want)
+	}
+}
+
+func TestEngine_NamedPredicate(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		".inco.json": `{"predicates": {
+  "validEmail": {"expr": "mail.IsEmail(%s)", "import": "example.com/app/mail"},
+  "positive": "%s > 0"
+}}`,
+		"main.go": `package main
+
+func Send(addr string, n, m int) {
+	// @inco: -is(validEmail) addr
+	// @inco: -is(positive) n, m, -return
+	_ = addr
+}
+`,
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	shadow := readShadow(t, e)
+	for _, want := range []string{
+		"if !(mail.IsEmail(addr)) {",
+		`panic("inco violation: addr must satisfy validEmail (at main.go:4)")`,
+		"if !((n > 0) && (m > 0)) {",
+		`"example.com/app/mail"`,
+	} {
+		if !strings.Contains(shadow, want) {
+			t.Errorf("missing %q in:\n%s", want, shadow)
+		}
+	}
+}
+
+func TestEngine_UnknownPredicate(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"main.go": `package main
+
+func Send(addr string) {
+	// @inco: -is(validEmail) addr
+	_ = addr
+}
+`,
+	})
+	err := NewEngine(dir).Run()
+	if err == nil || !strings.Contains(err.Error(), `unknown predicate "validEmail"`) {
+		t.Fatalf("expected unknown predicate error, got %v", err)
+	}
+
+	writeFile(t, filepath.Join(dir, ".inco.json"), `{"predicates": {"validMail": {"expr": "%s != \"\""}}}`)
+	err = NewEngine(dir).Run()
+	if err == nil || !strings.Contains(err.Error(), `unknown predicate "validEmail", did you mean validMail?`) {
+		t.Fatalf("expected a suggestion, got %v", err)
+	}
+}
+
+func TestEngine_ConfigChangeInvalidatesCache(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"main.go": `package main
+
+func F(p *int) {
+	// @inco: p != nil
+	_ = p
+}
+`,
+	})
+	if err := NewEngine(dir).Run(); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, ".inco.json"), `{"location_table": true}`)
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if shadow := readShadow(t, e); !strings.Contains(shadow, "_incoLoc_") {
+		t.Errorf("config change should regenerate the shadow, got:\n%s", shadow)
+	}
+}
+
+func TestEngine_MessageTemplate(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		".inco.json": `{"message_template": "{pkg}.{func}: {kind} violation: {detail} [{file}:{line}]"}`,
+		"main.go": `package main
+
+type Store struct{}
+
+func (s *Store) Get(key string) {
+	// @inco: key != ""
+	_ = key
+}
+
+func Put(v *int) {
+	f := func() {
+		// @inco: v != nil, -log
+	}
+	f()
+}
+
+func Load() {
+	err := Put2() // @inco: err == nil
+	_ = err
+}
+
+func Put2() error { return nil }
+`,
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	shadow := readShadow(t, e)
+	for _, want := range []string{
+		`panic("main.Store.Get: require violation: key != \"\" [main.go:6]")`,
+		`log.Println("main.Put: require violation: v != nil [main.go:12]")`,
+		`panic("main.Load: must violation: err == nil [main.go:18]")`,
+	} {
+		if !strings.Contains(shadow, want) {
+			t.Errorf("missing %q in:\n%s", want, shadow)
+		}
+	}
+}
+
+func TestEngine_MessageTemplateLocationTable(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		".inco.json": `{"location_table": true, "message_template": "{func} @ {loc}: {detail}"}`,
+		"main.go": `package main
+
+func F(p *int) {
+	// @inco: p != nil
+}
+`,
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	shadow := readShadow(t, e)
+	if !strings.Contains(shadow, `panic("F @ " + _incoLoc_`) || !strings.Contains(shadow, `[0] + ": p != nil")`) {
+		t.Errorf("{loc} should reference the location table, got:\n%s", shadow)
+	}
+}
+
+func TestEngine_BestEffort(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		".inco.json": `{"best_effort": ["third_party/"]}`,
+		"third_party/fork/fork.go": `package fork
+
+func F(p *int) {
+	// @inco: -is(unknownPredicate) p
+	// @inco: p != nil
+	_ = p
+}
+`,
+		"third_party/broken/broken.go": "package broken\n\nfunc {\n",
+		"main.go": `package main
+
+func G(p *int) {
+	// @inco: p != nil
+}
+`,
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatalf("best-effort files must not fail the run: %v", err)
+	}
+	fork := filepath.Join(dir, "third_party", "fork", "fork.go")
+	sp, ok := e.Overlay.Replace[fork]
+	if !ok {
+		t.Fatal("best-effort file should still be instrumented")
+	}
+	data, err := os.ReadFile(sp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shadow := string(data)
+	if !strings.Contains(shadow, "// @inco: -is(unknownPredicate) p") || !strings.Contains(shadow, "if !(p != nil) {") {
+		t.Errorf("failing directive should be kept as a comment, others generated:\n%s", shadow)
+	}
+	if _, ok := e.Overlay.Replace[filepath.Join(dir, "third_party", "broken", "broken.go")]; ok {
+		t.Error("unparsable best-effort file should be left out of the overlay")
+	}
+
+	// Outside the profile the same directive is an error.
+	writeFile(t, filepath.Join(dir, "main.go"), "package main\n\nfunc G(p *int) {\n\t// @inco: -is(unknownPredicate) p\n}\n")
+	if err := NewEngine(dir).Run(); err == nil {
+		t.Error("expected error outside best_effort paths")
+	}
+
+	// Strict mode turns best_effort off.
+	writeFile(t, filepath.Join(dir, "main.go"), "package main\n\nfunc G(p *int) {\n\t// @inco: p != nil\n}\n")
+	if err := os.Remove(filepath.Join(dir, "third_party", "broken", "broken.go")); err != nil {
+		t.Fatal(err)
+	}
+	e = NewEngine(dir)
+	e.Config.Strict = true
+	if err := e.Run(); err == nil || !strings.Contains(err.Error(), fork+":4:") {
+		t.Errorf("strict Run = %v, want an error at %s:4", err, fork)
+	}
+}
+
+func TestEngine_PanicViolation(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		".inco.json": `{"panic_value": "violation"}`,
+		"main.go": `package main
+
+func load() (int, error) { return 0, nil }
+
+func F(x int) int {
+	// @inco: x > 0
+	n, err := load() // @inco: err == nil, -wrap("load")
+	// @inco: x < 10, -msgf("x too big: %d", x)
+	return n
+}
+`,
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	shadow := readShadow(t, e)
+	for _, want := range []string{
+		`panic(inco.NewViolation("require", "main.F", "x > 0", "main.go", 6, nil))`,
+		`panic(inco.NewViolation("must", "main.F", "err == nil", "main.go", 7, fmt.Errorf("load: %w", err)))`,
+		`panic(fmt.Sprintf("x too big: %d", x))`,
+		`"github.com/imnive-design/inco-go/inco"`,
+	} {
+		if !strings.Contains(shadow, want) {
+			t.Errorf("missing %q in:\n%s", want, shadow)
+		}
+	}
+
+	writeFile(t, filepath.Join(dir, ".inco.json"), `{"panic_value": "error"}`)
+	if err := NewEngine(dir).Run(); err == nil || !strings.Contains(err.Error(), "unknown panic_value") {
+		t.Errorf("expected unknown panic_value error, got %v", err)
+	}
+}
+
+func TestEngine_Logger(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		".inco.json": `{"logger": {"expr": "zap.S().Errorw(%s)", "import": "go.uber.org/zap"}}`,
+		"main.go": `package main
+
+func F(x int) {
+	// @inco: x > 0, -log
+	// @inco: x < 10, -log("x too big", "x", x)
+}
+`,
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	shadow := readShadow(t, e)
+	for _, want := range []string{
+		`zap.S().Errorw("inco violation: x > 0 (at main.go:4)")`,
+		`zap.S().Errorw("x too big", "x", x)`,
+		`"go.uber.org/zap"`,
+	} {
+		if !strings.Contains(shadow, want) {
+			t.Errorf("missing %q in:\n%s", want, shadow)
+		}
+	}
+	if strings.Contains(shadow, `"log"`) {
+		t.Errorf("stdlib log should not be imported:\n%s", shadow)
+	}
+}
+
+func TestEngine_StackTrace(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		".inco.json": `{"stack_trace": true, "panic_value": "violation"}`,
+		"main.go": `package main
+
+func F(x int) {
+	// @inco: x > 0
+	// @inco: x < 10, -log
+	// @inco: x != 5, -slog
+}
+`,
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	shadow := readShadow(t, e)
+	for _, want := range []string{
+		`panic(inco.NewViolation("require", "main.F", "x > 0", "main.go", 4, nil).WithStack())`,
+		`log.Println("inco violation: x < 10 (at main.go:5)", "\n"+string(debug.Stack()))`,
+		`"stack", string(debug.Stack()))`,
+		`"runtime/debug"`,
+	} {
+		if !strings.Contains(shadow, want) {
+			t.Errorf("missing %q in:\n%s", want, shadow)
+		}
+	}
+}
+
+func TestEngine_Groups(t *testing.T) {
+	src := `package main
+
+func F(p *int, xs []int) {
+	// @inco: p != nil
+	// @inco[expensive]: sorted(xs)
+	// @inco[audit, nightly]: len(xs) < 1000
+}
+
+func sorted([]int) bool { return true }
+`
+	for _, tt := range []struct {
+		config string
+		want   []string
+		absent []string
+	}{
+		{"", []string{"!(p != nil)"}, []string{"!(sorted(xs))", "!(len(xs) < 1000)"}},
+		{`{"groups": ["expensive"]}`, []string{"!(p != nil)", "!(sorted(xs))"}, []string{"!(len(xs) < 1000)"}},
+		{`{"groups": ["nightly"]}`, []string{"!(p != nil)", "!(len(xs) < 1000)"}, []string{"!(sorted(xs))"}},
+	} {
+		files := map[string]string{"main.go": src}
+		if tt.config != "" {
+			files[".inco.json"] = tt.config
+		}
+		e := NewEngine(setupDir(t, files))
+		if err := e.Run(); err != nil {
+			t.Fatal(err)
+		}
+		shadow := readShadow(t, e)
+		for _, want := range tt.want {
+			if !strings.Contains(shadow, want) {
+				t.Errorf("%s: missing %q in:\n%s", tt.config, want, shadow)
+			}
+		}
+		for _, absent := range tt.absent {
+			if strings.Contains(shadow, absent) {
+				t.Errorf("%s: unexpected %q in:\n%s", tt.config, absent, shadow)
+			}
+		}
+	}
+}
+
+func TestEngine_GateTag(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		".inco.json": `{"gate_tag": "inco_off", "group_prologue": true}`,
+		"main.go": `package main
+
+func F(a, b *int, v any) {
+	// @inco: a != nil
+	// @inco: b != nil
+	_ = v
+	// @inco: -valid v
+}
+`,
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	shadow, err := os.ReadFile(e.Overlay.Replace[filepath.Join(dir, "main.go")])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"if _incoFail := func() int {\n\t\tif !incoChecksEnabled {\n\t\t\treturn -1\n\t\t}\n",
+		"if incoChecksEnabled {\n\t\tif err := validator.New().Struct(v); !(err == nil) {",
+	} {
+		if !strings.Contains(string(shadow), want) {
+			t.Errorf("missing %q in:\n%s", want, shadow)
+		}
+	}
+	for name, want := range map[string]string{
+		"inco_checks_on.go":  "//go:build !inco_off\n\npackage main\n\nconst incoChecksEnabled = true\n",
+		"inco_checks_off.go": "//go:build inco_off\n\npackage main\n\nconst incoChecksEnabled = false\n",
+	} {
+		sp, ok := e.Overlay.Replace[filepath.Join(dir, name)]
+		if !ok {
+			t.Fatalf("overlay has no %s", name)
+		}
+		data, err := os.ReadFile(sp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasSuffix(string(data), want) {
+			t.Errorf("%s:\n%s\nwant suffix:\n%s", name, data, want)
+		}
+	}
+	if e.Stats.Mapped != 1 {
+		t.Errorf("Mapped = %d, want 1 (gate files are not sources)", e.Stats.Mapped)
+	}
+}
+
+func TestEngine_Disable(t *testing.T) {
+	src := `package %s
+
+import "os"
+
+func F(p *int) {
+	// @inco: p != nil
+	// @inco: *p > 0, -log
+	f, err := os.Open("x") // @inco: err == nil
+	_ = f
+}
+`
+	dir := setupDir(t, map[string]string{
+		".inco.json":          `{"disable": [{"paths": ["exp/"], "kinds": ["must", "log"]}]}`,
+		"core/core.go":        fmt.Sprintf(src, "core"),
+		"exp/lab/lab.go":      fmt.Sprintf(src, "lab"),
+		"exp/lab/lab_more.go": "package lab\n",
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	read := func(rel string) string {
+		data, err := os.ReadFile(e.Overlay.Replace[filepath.Join(dir, rel)])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	core, lab := read("core/core.go"), read("exp/lab/lab.go")
+	for _, want := range []string{"!(p != nil)", "!(*p > 0)", "!(err == nil)"} {
+		if !strings.Contains(core, want) {
+			t.Errorf("core: missing %q in:\n%s", want, core)
+		}
+	}
+	if !strings.Contains(lab, "!(p != nil)") {
+		t.Errorf("lab: require directive should stay enabled:\n%s", lab)
+	}
+	for _, absent := range []string{"!(*p > 0)", "!(err == nil)"} {
+		if strings.Contains(lab, absent) {
+			t.Errorf("lab: unexpected %q in:\n%s", absent, lab)
+		}
+	}
+
+	writeFile(t, filepath.Join(dir, ".inco.json"), `{"disable": [{"paths": ["exp/"], "kinds": ["assume"]}]}`)
+	if err := NewEngine(dir).Run(); err == nil || !strings.Contains(err.Error(), `unknown directive kind "assume"`) {
+		t.Errorf("expected unknown kind error, got %v", err)
+	}
+}
+
+func TestEngine_Macros(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		".inco.json": `{"macros": {"nonEmptyID": "len(%s) > 0 && len(%s) < 64"}}`,
+		"main.go": `package main
+
+import "errors"
+
+var ErrInvalid = errors.New("invalid")
+
+func F(id string) error {
+	// @inco: @nonEmptyID(id), -return(ErrInvalid)
+	// See @example(x) for details.
+	return nil
+}
+`,
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	shadow := readShadow(t, e)
+	if !strings.Contains(shadow, "if !(len(id) > 0 && len(id) < 64) {\n\t\treturn ErrInvalid") {
+		t.Errorf("macro not expanded:\n%s", shadow)
+	}
+
+	writeFile(t, filepath.Join(dir, "main.go"), "package main\n\nfunc G(id string) {\n\t// @inco: @nonEmpty(id)\n}\n")
+	if err := NewEngine(dir).Run(); err == nil || !strings.Contains(err.Error(), "main.go:4: unknown macro @nonEmpty") {
+		t.Errorf("expected unknown macro error, got %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+package inco
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEngine_Contracts(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"main.go": "package main\n\nfunc main() {}\n",
+		"store/store.go": `package store
+
+import "strings"
+
+var Limit = 10 // @inco: Limit > 0
+
+type DB struct{}
+
+func (db *DB) Save(name string, u *User) (err error) {
+	// @inco: -nd u
+	// @inco: strings.TrimSpace(name) != "", -return(ErrName)
+	// @inco: err == nil, -ensure
+	err = db.write(u) // @inco: err == nil, -return(err)
+	func() {
+		// @inco: u.ID > 0
+	}()
+	return nil
+}
+`,
+		"store/types.go":       "package store\n\nimport \"errors\"\n\nvar ErrName = errors.New(\"name\")\n\ntype User struct{ ID int }\n\nfunc (db *DB) write(u *User) error { return nil }\n\nfunc Open(path string) *DB {\n\treturn &DB{}\n}\n",
+		".inco.contracts.json": `{"store": {"Open": ["path != \"\""]}}`,
+	})
+	e := NewEngine(dir)
+	pkgs, err := e.Contracts(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkgs) != 1 || pkgs[0].Dir != "store" || pkgs[0].Package != "store" {
+		t.Fatalf("packages = %+v, want only store", pkgs)
+	}
+	var got []string
+	for _, fc := range pkgs[0].Funcs {
+		got = append(got, fmt.Sprintf("%s %s:%d", fc.Name, fc.File, fc.Line))
+		for _, c := range fc.Contracts {
+			got = append(got, fmt.Sprintf("  %s %d %s %v %s%v", c.Kind, c.Line, c.Expr, c.Vars, c.Action, c.ActionArgs))
+		}
+	}
+	want := []string{
+		"DB.Save store/store.go:9",
+		"  require 10 !reflect.ValueOf(&u).Elem().IsZero() [u] panic[]",
+		`  require 11 strings.TrimSpace(name) != "" [name] return[ErrName]`,
+		"  ensure 12 err == nil [err] panic[]",
+		"  must 13 err == nil [err] return[err]",
+		"  require 15 u.ID > 0 [u] panic[]",
+		"Open store/types.go:11",
+		`  require 11 path != "" [path] panic[]`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("contracts:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if vars := pkgs[0].Vars; len(vars) != 1 || vars[0].Expr != "Limit > 0" || vars[0].File != "store/store.go" || vars[0].Line != 5 {
+		t.Errorf("package-level contracts = %+v, want Limit > 0 at store/store.go:5", vars)
+	}
+
+	out := t.TempDir()
+	if err := e.WriteContracts(context.Background(), out); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(out, "store", "contracts.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"expr": "!reflect.ValueOf(&u).Elem().IsZero()"`) {
+		t.Errorf("contracts.json should keep conditions as written:\n%s", data)
+	}
+	var written PackageContracts
+	if err := json.Unmarshal(data, &written); err != nil {
+		t.Fatal(err)
+	}
+	if len(written.Funcs) != 2 || written.Funcs[0].Name != "DB.Save" {
+		t.Errorf("contracts.json = %+v", written)
+	}
+	if _, err := os.Stat(filepath.Join(out, "contracts.json")); !os.IsNotExist(err) {
+		t.Errorf("package without contracts got a contracts.json: %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package inco
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEngine_RewriteCoverProfile(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"p/p.go": `package p
+
+func Half(n int) int {
+	// @inco: n%2 == 0, -return(-1)
+	m := n / 2
+	return m
+}
+`,
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(dir, "p", "p.go")
+	shadow := e.Overlay.Replace[src]
+	data, err := os.ReadFile(shadow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Find the shadow's own lines of the guard's return and the
+	// statements after it, as the cover tool numbers them.
+	lines := strings.Split(string(data), "\n")
+	raw := func(text string) int {
+		for i, l := range lines {
+			if strings.TrimSpace(l) == text {
+				return i + 1
+			}
+		}
+		t.Fatalf("shadow has no line %q:\n%s", text, data)
+		return 0
+	}
+	guard, stmt, ret := raw("return -1"), raw("m := n / 2"), raw("return m")
+	name := "example.com/m/p/" + filepath.Base(shadow)
+	profile := fmt.Sprintf("mode: count\n%s:%d.22,%d.18 1 4\n%s:%d.3,%d.12 1 1\n%s:%d.2,%d.10 2 3\nexample.com/m/q/q.go:3.20,5.2 1 7\n",
+		name, guard-2, guard-1, name, guard, guard, name, stmt, ret)
+
+	var out strings.Builder
+	if err := e.RewriteCoverProfile(strings.NewReader(profile), &out); err != nil {
+		t.Fatal(err)
+	}
+	want := "mode: count\n" +
+		"example.com/m/p/p.go:3.22,4.18 1 4\n" + // ends at the guard's condition, on the directive line
+		"example.com/m/p/p.go:5.2,6.10 2 3\n" +
+		"example.com/m/q/q.go:3.20,5.2 1 7\n"
+	if out.String() != want {
+		t.Errorf("rewritten profile:\n%s\nwant:\n%s", out.String(), want)
+	}
+
+	// Without a Run, the overlay.json of the last one is used; absolute
+	// names stay absolute.
+	profile = fmt.Sprintf("mode: set\n%s:%d.2,%d.10 2 1\n%s:%d.2,%d.10 2 0\n", shadow, stmt, ret, shadow, stmt, ret)
+	out.Reset()
+	if err := NewEngine(dir).RewriteCoverProfile(strings.NewReader(profile), &out); err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf("mode: set\n%s:5.2,6.10 2 1\n", src); out.String() != want {
+		t.Errorf("rewritten profile:\n%s\nwant:\n%s", out.String(), want)
+	}
+
+	if err := e.RewriteCoverProfile(strings.NewReader("p.go:1.1,2.2 1 1\n"), &out); err == nil {
+		t.Error("profile without a mode line should fail")
+	}
+}
@@ -0,0 +1,115 @@
+package inco
+
+import (
+	"context"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDaemon(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"main.go": "package main\n\nfunc F(p *int) {\n\t// @inco: p != nil\n}\n",
+	})
+	if err := os.MkdirAll(filepath.Join(dir, ".inco_cache"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("unix", DaemonSocket(dir))
+	if err != nil {
+		t.Skipf("unix sockets not available: %v", err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- NewDaemon(dir).Serve(context.Background(), l) }()
+	call := func(req DaemonRequest) DaemonResponse {
+		t.Helper()
+		resp, err := CallDaemon(context.Background(), dir, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Error != "" {
+			t.Fatalf("%s: %s", req.Op, resp.Error)
+		}
+		return resp
+	}
+
+	resp := call(DaemonRequest{Op: DaemonGen})
+	if resp.Report == nil || resp.Report.Mapped != 1 || resp.Report.Processed != 1 || resp.Overlay != filepath.Join(dir, ".inco_cache", "overlay.json") {
+		t.Fatalf("first gen = %+v", resp)
+	}
+	if resp = call(DaemonRequest{Op: DaemonGen}); resp.Report.Cached != 1 || resp.Report.Processed != 0 {
+		t.Errorf("second gen: cached %d, processed %d; want the shadow reused", resp.Report.Cached, resp.Report.Processed)
+	}
+
+	// Lint reads unsaved buffers and writes nothing.
+	path := filepath.Join(dir, "main.go")
+	resp = call(DaemonRequest{Op: DaemonLint, Files: []string{path}, Buffers: map[string]string{
+		path: "package main\n\nfunc F(p *int) {\n\t// @inco: p != nil, -break(L)\n\t// @inco oops\n}\n",
+	}})
+	if len(resp.Diagnostics) != 1 || resp.Diagnostics[0].Line != 4 || !strings.Contains(resp.Diagnostics[0].Message, "-break(L)") {
+		t.Errorf("lint diagnostics = %v, want the -break(L) error at line 4", resp.Diagnostics)
+	}
+	resp = call(DaemonRequest{Op: DaemonLint, Files: []string{path}, Buffers: map[string]string{
+		path: "package main\n\nfunc F(p *int) {\n\t// @inco oops\n}\n",
+	}})
+	if len(resp.Diagnostics) != 1 || resp.Diagnostics[0].Line != 4 || !strings.Contains(resp.Diagnostics[0].Message, "malformed directive") {
+		t.Errorf("lint diagnostics = %v, want the malformed directive warning", resp.Diagnostics)
+	}
+
+	if resp, _ := CallDaemon(context.Background(), dir, DaemonRequest{Op: "frobnicate"}); !strings.Contains(resp.Error, "unknown op") {
+		t.Errorf("unknown op: error = %q", resp.Error)
+	}
+	call(DaemonRequest{Op: DaemonStop})
+	if err := <-served; err != nil {
+		t.Fatalf("Serve = %v after stop", err)
+	}
+	if _, err := CallDaemon(context.Background(), dir, DaemonRequest{Op: DaemonGen}); err == nil {
+		t.Error("daemon still answering after stop")
+	}
+}
+
+func TestEngine_Warm(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go toolchain not available")
+	}
+	dir := setupDir(t, map[string]string{
+		"go.mod":   "module example.com/m\n\ngo 1.22\n",
+		"a/a.go":   "package a\n\nvar Zero int\n",
+		"b/b.go":   "package b\n\nimport \"example.com/m/a\"\n\nfunc B(n int) int {\n\t// @inco: n > 0, -return(a.Zero)\n\treturn n\n}\n",
+		"c/c.go":   "package c\n\nfunc C(p *int) {\n\t// @inco: p != nil\n}\n",
+		"d/doc.go": "package d\n",
+	})
+	e := NewEngine(dir)
+	e.Warm = true
+	e.Config.Typecheck = true
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	imp := e.warm.imp
+
+	// A change outside the imported packages keeps the importer.
+	write := func(rel, src string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, rel), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("c/c.go", "package c\n\nfunc C(p *int) {\n\t// @inco: p != nil, -panic(\"nil\")\n}\n")
+	write("b/b.go", "package b\n\nimport \"example.com/m/a\"\n\nfunc B(n int) int {\n\t// @inco: n >= 0, -return(a.Zero)\n\treturn n\n}\n")
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if e.warm.imp != imp {
+		t.Error("importer discarded, though no imported package changed")
+	}
+
+	// A change to an imported package is seen by the next typecheck.
+	write("a/a.go", "package a\n\nvar Zero string\n")
+	write("b/b.go", "package b\n\nimport \"example.com/m/a\"\n\nfunc B(n int) int {\n\t// @inco: n > 0, -return(a.Zero)\n\treturn n\n}\n")
+	err := e.Run()
+	if err == nil || !strings.Contains(err.Error(), filepath.Join(dir, "b", "b.go")+":6: generated code: ") {
+		t.Errorf("Run error = %v, want the return of a.Zero, now a string", err)
+	}
+}
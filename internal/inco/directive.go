@@ -3,23 +3,37 @@
 package inco
 
 import (
+	"go/ast"
+	"go/parser"
+	"go/token"
 	"regexp"
+	"strconv"
 	"strings"
 )
 
+// optionNames lists the options a directive may end with, as an
+// alternation.
+const optionNames = "panic|return|continue|break|log|slog|warn|msgf|wrap|except|retry|call|metric|sample|logonce|logevery|ensure|onsuccess|onerror"
+
 var (
 	// directiveRe matches the body after stripping comment delimiters.
-	// Group 1: everything after "@inco: "
-	directiveRe = regexp.MustCompile(`^@inco:\s+(.+)$`)
+	// Group 1: contract groups, e.g. "expensive" in "@inco[expensive]:" (optional)
+	// Group 2: everything after "@inco: "
+	directiveRe = regexp.MustCompile(`^@inco(?:\[([^\]]+)\])?:\s+(.+)$`)
 
-	// actionRe splits "expr, -action(args)" into components.
-	// Greedy (.+) backtracks to find the last top-level ", -action..." —
-	// this naturally handles commas inside parenthesized sub-expressions.
+	// actionRe splits "expr, -option(args)" into components, where the
+	// option is an action or a message option such as -msgf. Greedy (.+)
+	// backtracks to find the last top-level ", -option..." — this naturally
+	// handles commas inside parenthesized sub-expressions. ParseDirective
+	// applies it repeatedly to peel off several trailing options.
 	//
-	// Group 1: expression
-	// Group 2: action name (panic|return|continue|break)
-	// Group 3: action arguments (optional)
-	actionRe = regexp.MustCompile(`^(.+),\s*-(panic|return|continue|break|log)(?:\((.+)\))?\s*$`)
+	// Group 1: expression (plus any earlier options)
+	// Group 2: option name (one of optionNames)
+	// Group 3: option arguments (optional)
+	actionRe = regexp.MustCompile(`^(.+),\s*-(` + optionNames + `)(?:\((.+)\))?\s*$`)
+
+	// optionNameRe matches the names of the options ParseDirective knows.
+	optionNameRe = regexp.MustCompile(`^(?:` + optionNames + `)$`)
 
 	// commentRe strips Go comment delimiters.
 	// Group 1: content of // comment
@@ -34,13 +48,26 @@ var actionFromName = map[string]ActionKind{
 	"continue": ActionContinue,
 	"break":    ActionBreak,
 	"log":      ActionLog,
+	"slog":     ActionSlog,
+	"warn":     ActionWarn,
 }
 
 // ParseDirective extracts a Directive from a comment string.
 // Returns nil when the comment is not a valid @inco: directive.
 //
-// Syntax: @inco: <expr>[, -action[(args...)]]
+// Syntax: @inco[groups]: <expr>[, -action[(args...)]][, -msgf(format, args...)][, -wrap("context")][, -except(errs...)][, -retry(n[, backoff])][, -call(handler)][, -metric("name")][, -sample(rate)][, -logonce | -logevery(n)][, -ensure | -onsuccess | -onerror]
+//
+// <expr> may also be a condition flag such as -oneof("a", "b") x, which
+// is expanded into a plain Go expression (see flag.go), or a DSL condition
+// -dsl(lang) src, translated by the engine (see translate.go).
 func ParseDirective(comment string) *Directive {
+	return parseDirective(comment, "")
+}
+
+// parseDirective is ParseDirective with a default action: when the
+// directive names none, def (e.g. "-return(ErrInvalid)", from an
+// //inco:default pragma) applies as if written at the end of the comment.
+func parseDirective(comment, def string) *Directive {
 	body := stripComment(comment)
 //line /Users/hitomikirigiri/Desktop/imnive/inco/internal/inco/directive.inco.go:43
 	if !(body != "") {
@@ -54,27 +81,279 @@ func ParseDirective(comment string) *Directive {
 		return nil
 	}
 //line /Users/hitomikirigiri/Desktop/imnive/inco/internal/inco/directive.inco.go:47
-	rest := m[1]
+	rest := m[2]
 
 	d := &Directive{Action: ActionPanic}
-	if am := actionRe.FindStringSubmatch(rest); am != nil {
-		d.Expr = strings.TrimSpace(am[1])
+	if m[1] != "" {
+		d.Groups = splitTopLevel(m[1])
+		_ = d // @inco: len(d.Groups) > 0, -return(nil)
+		if !(len(d.Groups) > 0) {
+			return nil
+		}
+		for _, g := range d.Groups {
+			_ = g // @inco: identRe.MatchString(g), -return(nil)
+			if !(identRe.MatchString(g)) {
+				return nil
+			}
+		}
+	}
+	hasAction := false
+	for {
+		am := actionRe.FindStringSubmatch(rest)
+		if am == nil {
+			break
+		}
+		rest = strings.TrimSpace(am[1])
+		switch am[2] {
+		case "msgf":
+			_ = am // @inco: am[3] != "" && d.Msgf == nil, -return(nil)
+			if !(am[3] != "" && d.Msgf == nil) {
+				return nil
+			}
+			d.Msgf = splitTopLevel(am[3])
+			continue
+		case "wrap":
+			_, err := strconv.Unquote(am[3])
+			_ = err // @inco: err == nil && d.Wrap == "", -return(nil)
+			if !(err == nil && d.Wrap == "") {
+				return nil
+			}
+			d.Wrap = am[3]
+			continue
+		case "except":
+			_ = am // @inco: am[3] != "" && d.Except == nil, -return(nil)
+			if !(am[3] != "" && d.Except == nil) {
+				return nil
+			}
+			d.Except = splitTopLevel(am[3])
+			continue
+		case "retry":
+			args := splitTopLevel(am[3])
+			_ = args // @inco: (len(args) == 1 || len(args) == 2) && d.Retry == nil, -return(nil)
+			if !((len(args) == 1 || len(args) == 2) && d.Retry == nil) {
+				return nil
+			}
+			for _, a := range args {
+				_, err := parser.ParseExpr(a)
+				_ = err // @inco: err == nil, -return(nil)
+				if !(err == nil) {
+					return nil
+				}
+			}
+			d.Retry = args
+			continue
+		case "call":
+			_, err := parser.ParseExpr(am[3])
+			_ = err // @inco: am[3] != "" && err == nil && d.Call == "", -return(nil)
+			if !(am[3] != "" && err == nil && d.Call == "") {
+				return nil
+			}
+			d.Call = am[3]
+			continue
+		case "metric":
+			_, err := strconv.Unquote(am[3])
+			_ = err // @inco: err == nil && d.Metric == "", -return(nil)
+			if !(err == nil && d.Metric == "") {
+				return nil
+			}
+			d.Metric = am[3]
+			continue
+		case "sample":
+			_, err := parser.ParseExpr(am[3])
+			_ = err // @inco: am[3] != "" && err == nil && d.Sample == "", -return(nil)
+			if !(am[3] != "" && err == nil && d.Sample == "") {
+				return nil
+			}
+			d.Sample = am[3]
+			continue
+		case "logonce":
+			_ = am // @inco: am[3] == "" && !d.LogOnce, -return(nil)
+			if !(am[3] == "" && !d.LogOnce) {
+				return nil
+			}
+			d.LogOnce = true
+			continue
+		case "logevery":
+			_, err := parser.ParseExpr(am[3])
+			_ = err // @inco: am[3] != "" && err == nil && d.LogEvery == "", -return(nil)
+			if !(am[3] != "" && err == nil && d.LogEvery == "") {
+				return nil
+			}
+			d.LogEvery = am[3]
+			continue
+		case "ensure", "onsuccess", "onerror":
+			_ = am // @inco: am[3] == "" && d.Ensure == "", -return(nil)
+			if !(am[3] == "" && d.Ensure == "") {
+				return nil
+			}
+			d.Ensure = am[2]
+			continue
+		}
+		_ = hasAction // @inco: !hasAction, -return(nil)
+		if !(!hasAction) {
+			return nil
+		}
+		hasAction = true
 		d.Action = actionFromName[am[2]]
 		if am[3] != "" {
 			d.ActionArgs = splitTopLevel(am[3])
 		}
-	} else {
-		d.Expr = rest
+	}
+	if !hasAction && def != "" {
+		return parseDirective("// "+body+", "+def, "")
+	}
+	d.Expr = rest
+	// -break and -continue take at most a label.
+	_ = d // @inco: (d.Action != ActionBreak && d.Action != ActionContinue) || d.ActionArgs == nil || (len(d.ActionArgs) == 1 && identRe.MatchString(d.ActionArgs[0])), -return(nil)
+	if !((d.Action != ActionBreak && d.Action != ActionContinue) || d.ActionArgs == nil || (len(d.ActionArgs) == 1 && identRe.MatchString(d.ActionArgs[0]))) {
+		return nil
+	}
+	if d.Metric != "" && !hasAction {
+		// Observe-only: count the violation and carry on.
+		d.Action = ActionMetric
 	}
 
+	// -msgf replaces the default message, so it only combines with a bare
+	// panic or log, or with slog and warn, whose arguments are extra
+	// attributes.
+	_ = d // @inco: d.Msgf == nil || d.Action.structured() || ((d.Action == ActionPanic || d.Action == ActionLog) && d.ActionArgs == nil), -return(nil)
+	if !(d.Msgf == nil || d.Action.structured() || ((d.Action == ActionPanic || d.Action == ActionLog) && d.ActionArgs == nil)) {
+		return nil
+	}
+	// Rate limiting applies to logging actions only, and one at a time.
+	_ = d // @inco: !(d.LogOnce && d.LogEvery != ""), -return(nil)
+	if !(!(d.LogOnce && d.LogEvery != "")) {
+		return nil
+	}
+	_ = d // @inco: (!d.LogOnce && d.LogEvery == "") || d.Action == ActionLog || d.Action.structured(), -return(nil)
+	if !((!d.LogOnce && d.LogEvery == "") || d.Action == ActionLog || d.Action.structured()) {
+		return nil
+	}
+	_ = d // @inco: d.Wrap == "" || validWrap(d), -return(nil)
+	if !(d.Wrap == "" || validWrap(d)) {
+		return nil
+	}
+	_ = d // @inco: d.Except == nil || len(errVars(d.Expr)) == 1, -return(nil)
+	if !(d.Except == nil || len(errVars(d.Expr)) == 1) {
+		return nil
+	}
+	// all(xs, func...) and any(xs, func...) expand like -all and -any.
+	expandQuantifierCall(d)
+
 //line /Users/hitomikirigiri/Desktop/imnive/inco/internal/inco/directive.inco.go:60
 	if !(d.Expr != "") {
 		return nil
 	}
 //line /Users/hitomikirigiri/Desktop/imnive/inco/internal/inco/directive.inco.go:61
+	if strings.HasPrefix(d.Expr, "-dsl(") {
+		ok := parseDSL(d)
+		_ = ok // @inco: ok, -return(nil)
+		if !(ok) {
+			return nil
+		}
+	} else if isFlagExpr(d.Expr) {
+		ok := expandFlag(d)
+		_ = ok // @inco: ok, -return(nil)
+		if !(ok) {
+			return nil
+		}
+	}
+	// A postcondition runs in a deferred function, where control-flow
+	// actions have nothing to act on.
+	_ = d // @inco: d.Ensure == "" || validEnsure(d), -return(nil)
+	if !(d.Ensure == "" || validEnsure(d)) {
+		return nil
+	}
+	// -valid binds err in the guard's init statement, which a retry loop
+	// condition cannot repeat.
+	_ = d // @inco: d.Retry == nil || d.Flag != "valid", -return(nil)
+	if !(d.Retry == nil || d.Flag != "valid") {
+		return nil
+	}
+	// A sampled -valid would still run the validator on every call, and a
+	// sampled retry loop makes no sense.
+	_ = d // @inco: d.Sample == "" || (d.Flag != "valid" && d.Retry == nil), -return(nil)
+	if !(d.Sample == "" || (d.Flag != "valid" && d.Retry == nil)) {
+		return nil
+	}
 	return d
 }
 
+// validWrap reports whether a -wrap option has an error to wrap and an
+// action that carries it: a return naming one of the errors, a bare panic
+// or log, or slog and warn.
+func validWrap(d *Directive) bool {
+	ev := errVars(d.Expr)
+	if !(len(ev) > 0 && (d.Msgf == nil || d.Action.structured())) {
+		return false
+	}
+	switch d.Action {
+	case ActionReturn:
+		for _, a := range d.ActionArgs {
+			if isErrVar(ev, a) {
+				return true
+			}
+		}
+		return false
+	case ActionPanic, ActionLog:
+		return d.ActionArgs == nil
+	case ActionSlog, ActionWarn:
+		return true
+	}
+	return false
+}
+
+// validEnsure reports whether a postcondition has an action that can run
+// in a deferred function and no option that needs the statement's
+// position.
+func validEnsure(d *Directive) bool {
+	switch d.Action {
+	case ActionPanic, ActionLog, ActionSlog, ActionWarn, ActionMetric:
+		return d.Retry == nil && d.Flag != "valid"
+	}
+	return false
+}
+
+// errVars returns the identifiers x the expression requires to be nil,
+// i.e. the operands of "x == nil" terms in a top-level && chain.
+func errVars(expr string) []string {
+	x, err := parser.ParseExpr(expr)
+	_ = err // @inco: err == nil, -return(nil)
+	if !(err == nil) {
+		return nil
+	}
+	var out []string
+	var walk func(ast.Expr)
+	walk = func(x ast.Expr) {
+		switch b := ast.Unparen(x).(type) {
+		case *ast.BinaryExpr:
+			switch b.Op {
+			case token.LAND:
+				walk(b.X)
+				walk(b.Y)
+			case token.EQL:
+				id, ok := ast.Unparen(b.X).(*ast.Ident)
+				nilY, okY := ast.Unparen(b.Y).(*ast.Ident)
+				if ok && okY && nilY.Name == "nil" {
+					out = append(out, id.Name)
+				}
+			}
+		}
+	}
+	walk(x)
+	return out
+}
+
+// isErrVar reports whether name is one of the error variables ev.
+func isErrVar(ev []string, name string) bool {
+	for _, v := range ev {
+		if v == name {
+			return true
+		}
+	}
+	return false
+}
+
 // ---------------------------------------------------------------------------
 // Helpers
 // ---------------------------------------------------------------------------
@@ -95,6 +374,25 @@ func stripComment(s string) string {
 	return m[2]
 }
 
+// strayOption returns the first option left in expr, the condition of a
+// directive, because ParseDirective could not take it: one with an
+// unknown name, such as "-ret(nil)", or a known one whose arguments do not
+// parse. A top-level comma is never part of a Go expression, so whatever
+// follows one and starts like an option is taken for one. name is "" when
+// expr has none.
+func strayOption(expr string) (name, text string) {
+	parts := splitTopLevel(expr)
+	for i := 1; i < len(parts); i++ {
+		if m := strayOptionRe.FindStringSubmatch(parts[i]); m != nil {
+			return m[1], parts[i]
+		}
+	}
+	return "", ""
+}
+
+// strayOptionRe matches the start of an option: "-name".
+var strayOptionRe = regexp.MustCompile(`^-([A-Za-z]\w*)`)
+
 // splitTopLevel splits s by top-level commas, respecting nested parens,
 // brackets, braces, double-quoted strings, and raw strings (backtick).
 func splitTopLevel(s string) []string {
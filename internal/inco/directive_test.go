@@ -166,10 +166,29 @@ func TestParseDirective_Break(t *testing.T) {
 	}
 }
 
+func TestParseDirective_BreakLabel(t *testing.T) {
+	d := ParseDirective("// @inco: n != 42, -continue(outer)")
+	if d == nil {
+		t.Fatal("got nil")
+	}
+	if d.Action != ActionContinue || len(d.ActionArgs) != 1 || d.ActionArgs[0] != "outer" {
+		t.Errorf("Action = %v %q, want continue [outer]", d.Action, d.ActionArgs)
+	}
+	for _, bad := range []string{
+		"// @inco: ok, -break(a, b)",
+		"// @inco: ok, -break(a.b)",
+		`// @inco: ok, -continue("outer")`,
+	} {
+		if d := ParseDirective(bad); d != nil {
+			t.Errorf("ParseDirective(%q) = %+v, want nil", bad, d)
+		}
+	}
+}
+
 func TestBuildPanicBody_Do(t *testing.T) {
 	e := NewEngine(t.TempDir())
 	d := &Directive{Action: ActionDo, Expr: "x != nil", ActionArgs: []string{`log.Println("x is nil")`}}
-	body := e.buildPanicBody(d, "test.go", 1)
+	body := e.buildPanicBody(newShadowGen("test.go", "test.go"), d, 1)
 	want := `log.Println("x is nil")`
 	if body != want {
 		t.Errorf("got %q, want %q", body, want)
@@ -179,7 +198,7 @@ func TestBuildPanicBody_Do(t *testing.T) {
 func TestBuildPanicBody_DoMultiExpr(t *testing.T) {
 	e := NewEngine(t.TempDir())
 	d := &Directive{Action: ActionDo, Expr: "ok", ActionArgs: []string{"count++", `log.Println("fail")`}}
-	body := e.buildPanicBody(d, "test.go", 1)
+	body := e.buildPanicBody(newShadowGen("test.go", "test.go"), d, 1)
 	want := `count++; log.Println("fail")`
 	if body != want {
 		t.Errorf("got %q, want %q", body, want)
@@ -338,3 +357,288 @@ func TestSplitTopLevel(t *testing.T) {
 		}
 	}
 }
+
+func TestParseDirective_Msgf(t *testing.T) {
+	d := ParseDirective(`// @inco: amount > 0, -msgf("bad amount %d for user %s", amount, userID)`)
+	if d == nil {
+		t.Fatal("got nil")
+	}
+	if d.Expr != "amount > 0" {
+		t.Errorf("Expr = %q", d.Expr)
+	}
+	want := []string{`"bad amount %d for user %s"`, "amount", "userID"}
+	if len(d.Msgf) != len(want) {
+		t.Fatalf("Msgf = %v, want %v", d.Msgf, want)
+	}
+	for i := range want {
+		if d.Msgf[i] != want[i] {
+			t.Errorf("Msgf[%d] = %q, want %q", i, d.Msgf[i], want[i])
+		}
+	}
+}
+
+func TestParseDirective_MsgfWithLog(t *testing.T) {
+	for _, input := range []string{
+		`// @inco: x > 0, -log, -msgf("x = %d", x)`,
+		`// @inco: x > 0, -msgf("x = %d", x), -log`,
+	} {
+		d := ParseDirective(input)
+		if d == nil {
+			t.Fatalf("ParseDirective(%q) = nil", input)
+		}
+		if d.Action != ActionLog || d.Expr != "x > 0" || len(d.Msgf) != 2 {
+			t.Errorf("ParseDirective(%q) = %+v", input, d)
+		}
+	}
+}
+
+func TestParseDirective_MsgfInvalid(t *testing.T) {
+	for _, input := range []string{
+		`// @inco: x > 0, -msgf`,                   // no format
+		`// @inco: x > 0, -return, -msgf("x")`,     // message unused
+		`// @inco: x > 0, -panic("p"), -msgf("x")`, // conflicting messages
+		`// @inco: x > 0, -msgf("a"), -msgf("b")`,  // duplicate
+		`// @inco: x > 0, -return, -panic`,         // two actions
+	} {
+		if d := ParseDirective(input); d != nil {
+			t.Errorf("ParseDirective(%q) = %+v, want nil", input, d)
+		}
+	}
+}
+
+func TestParseDirective_Wrap(t *testing.T) {
+	d := ParseDirective(`// @inco: err == nil, -return(nil, err), -wrap("load user")`)
+	if d == nil {
+		t.Fatal("got nil")
+	}
+	if d.Wrap != `"load user"` || d.Action != ActionReturn || d.Expr != "err == nil" {
+		t.Errorf("got %+v", d)
+	}
+	if ParseDirective(`// @inco: err == nil, -wrap("load")`) == nil {
+		t.Error("-wrap with default panic should be accepted")
+	}
+	if ParseDirective(`// @inco: a == nil && b == nil, -return(b), -wrap("x")`) == nil {
+		t.Error("-wrap over several errors should be accepted")
+	}
+}
+
+func TestParseDirective_WrapInvalid(t *testing.T) {
+	for _, input := range []string{
+		`// @inco: err == nil, -return(nil), -wrap("x")`, // error not returned
+		`// @inco: ok, -wrap("x")`,                       // no error operand
+		`// @inco: err == nil, -wrap(ctx)`,               // not a literal
+		`// @inco: err == nil, -continue, -wrap("x")`,    // action has no value
+		`// @inco: err == nil, -msgf("m"), -wrap("x")`,   // conflicting messages
+		`// @inco: err == nil, -panic(err), -wrap("x")`,  // explicit panic value
+		`// @inco: err == nil, -wrap("a"), -wrap("b")`,   // duplicate
+	} {
+		if d := ParseDirective(input); d != nil {
+			t.Errorf("ParseDirective(%q) = %+v, want nil", input, d)
+		}
+	}
+}
+
+func TestErrVars(t *testing.T) {
+	tests := []struct {
+		expr string
+		want []string
+	}{
+		{"err == nil", []string{"err"}},
+		{"(err == nil) && ok", []string{"err"}},
+		{"a == nil && b == nil", []string{"a", "b"}},
+		{"err != nil", nil},
+		{"err == nil || ok", nil},
+	}
+	for _, tt := range tests {
+		got := errVars(tt.expr)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("errVars(%q) = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestParseDirective_Except(t *testing.T) {
+	d := ParseDirective(`// @inco: err == nil, -return(err), -except(io.EOF, sql.ErrNoRows)`)
+	if d == nil {
+		t.Fatal("got nil")
+	}
+	if !reflect.DeepEqual(d.Except, []string{"io.EOF", "sql.ErrNoRows"}) {
+		t.Errorf("Except = %v", d.Except)
+	}
+	if d.Expr != "err == nil" || d.Action != ActionReturn {
+		t.Errorf("got %+v", d)
+	}
+	for _, input := range []string{
+		`// @inco: ok, -except(io.EOF)`, // no error operand
+		`// @inco: err == nil, -except`, // no sentinels
+		`// @inco: err == nil, -except(io.EOF), -except(io.ErrClosedPipe)`,
+	} {
+		if d := ParseDirective(input); d != nil {
+			t.Errorf("ParseDirective(%q) = %+v, want nil", input, d)
+		}
+	}
+}
+
+func TestParseDirective_Retry(t *testing.T) {
+	d := ParseDirective(`// @inco: err == nil, -return(err), -retry(3, 100*time.Millisecond)`)
+	if d == nil {
+		t.Fatal("got nil")
+	}
+	if !reflect.DeepEqual(d.Retry, []string{"3", "100*time.Millisecond"}) || d.Action != ActionReturn {
+		t.Errorf("got %+v", d)
+	}
+	for _, input := range []string{
+		`// @inco: err == nil, -retry`,          // no count
+		`// @inco: err == nil, -retry(1, 2, 3)`, // too many args
+		`// @inco: err == nil, -retry(3 +)`,     // bad count
+		`// @inco: -valid req, -retry(3)`,       // init-bound condition
+	} {
+		if d := ParseDirective(input); d != nil {
+			t.Errorf("ParseDirective(%q) = %+v, want nil", input, d)
+		}
+	}
+}
+
+func TestParseDirective_Call(t *testing.T) {
+	d := ParseDirective(`// @inco: err == nil, -return(err), -call(metrics.Report)`)
+	if d == nil {
+		t.Fatal("got nil")
+	}
+	if d.Call != "metrics.Report" || d.Action != ActionReturn || d.Expr != "err == nil" {
+		t.Errorf("got %+v", d)
+	}
+	for _, input := range []string{
+		`// @inco: x > 0, -call`,              // no handler
+		`// @inco: x > 0, -call(a +)`,         // not an expression
+		`// @inco: x > 0, -call(a), -call(b)`, // duplicate
+	} {
+		if d := ParseDirective(input); d != nil {
+			t.Errorf("ParseDirective(%q) = %+v, want nil", input, d)
+		}
+	}
+}
+
+func TestParseDirective_Metric(t *testing.T) {
+	d := ParseDirective(`// @inco: x > 0, -metric("bad_x")`)
+	if d == nil {
+		t.Fatal("got nil")
+	}
+	if d.Metric != `"bad_x"` || d.Action != ActionMetric {
+		t.Errorf("got %+v, want observe-only metric", d)
+	}
+	d = ParseDirective(`// @inco: x > 0, -return(0), -metric("bad_x")`)
+	if d == nil || d.Action != ActionReturn || d.Metric != `"bad_x"` {
+		t.Errorf("got %+v, want counted return", d)
+	}
+	for _, input := range []string{
+		`// @inco: x > 0, -metric`,                    // no name
+		`// @inco: x > 0, -metric(name)`,              // not a literal
+		`// @inco: x > 0, -metric("a"), -metric("b")`, // duplicate
+	} {
+		if d := ParseDirective(input); d != nil {
+			t.Errorf("ParseDirective(%q) = %+v, want nil", input, d)
+		}
+	}
+}
+
+func TestParseDirective_Slog(t *testing.T) {
+	d := ParseDirective(`// @inco: err == nil, -slog("user", id), -msgf("load %s", id), -wrap("load")`)
+	if d == nil {
+		t.Fatal("got nil")
+	}
+	if d.Action != ActionSlog || !reflect.DeepEqual(d.ActionArgs, []string{`"user"`, "id"}) || d.Msgf == nil || d.Wrap == "" {
+		t.Errorf("got %+v", d)
+	}
+	if d := ParseDirective(`// @inco: x > 0, -slog`); d == nil || d.Action != ActionSlog {
+		t.Errorf("bare -slog: got %+v", d)
+	}
+}
+
+func TestParseDirective_Sample(t *testing.T) {
+	d := ParseDirective(`// @inco: -nd a:"a unset", b:"b unset", -sample(0.01)`)
+	if d == nil {
+		t.Fatal("got nil")
+	}
+	if d.Sample != "0.01" || len(d.Each) != 2 || d.Each[1].Sample != "0.01" {
+		t.Errorf("got %+v", d)
+	}
+	for _, input := range []string{
+		`// @inco: x > 0, -sample`,                      // no rate
+		`// @inco: -valid req, -sample(0.1)`,            // validator runs anyway
+		`// @inco: err == nil, -retry(3), -sample(0.1)`, // sampled retry
+	} {
+		if d := ParseDirective(input); d != nil {
+			t.Errorf("ParseDirective(%q) = %+v, want nil", input, d)
+		}
+	}
+}
+
+func TestParseDirective_LogThrottle(t *testing.T) {
+	if d := ParseDirective(`// @inco: x > 0, -log, -logonce`); d == nil || !d.LogOnce {
+		t.Errorf("-logonce: got %+v", d)
+	}
+	if d := ParseDirective(`// @inco: x > 0, -slog, -logevery(100)`); d == nil || d.LogEvery != "100" {
+		t.Errorf("-logevery: got %+v", d)
+	}
+	for _, input := range []string{
+		`// @inco: x > 0, -logonce`,                     // default panic
+		`// @inco: x > 0, -return, -logevery(10)`,       // not a log action
+		`// @inco: x > 0, -log, -logonce, -logevery(2)`, // both
+		`// @inco: x > 0, -log, -logevery`,              // no count
+	} {
+		if d := ParseDirective(input); d != nil {
+			t.Errorf("ParseDirective(%q) = %+v, want nil", input, d)
+		}
+	}
+}
+
+func TestParseDirective_Groups(t *testing.T) {
+	d := ParseDirective(`// @inco[expensive, nightly]: deepValidate(x), -return(err)`)
+	if d == nil {
+		t.Fatal("expected directive")
+	}
+	if len(d.Groups) != 2 || d.Groups[0] != "expensive" || d.Groups[1] != "nightly" {
+		t.Errorf("Groups = %v", d.Groups)
+	}
+	if d.Expr != "deepValidate(x)" || d.Action != ActionReturn {
+		t.Errorf("got %+v", d)
+	}
+	if d := ParseDirective(`// @inco: x > 0`); d == nil || d.Groups != nil {
+		t.Errorf("untagged directive: got %+v", d)
+	}
+	for _, input := range []string{
+		`// @inco[]: x > 0`,
+		`// @inco[ ]: x > 0`,
+		`// @inco[a-b]: x > 0`,
+		`// @inco[expensive] x > 0`,
+	} {
+		if d := ParseDirective(input); d != nil {
+			t.Errorf("ParseDirective(%q) = %+v, want nil", input, d)
+		}
+	}
+}
+
+func TestParseDirective_Ensure(t *testing.T) {
+	for input, want := range map[string]string{
+		`// @inco: n >= 0, -ensure`:                  EnsureAlways,
+		`// @inco: res != nil, -onsuccess`:           EnsureOnSuccess,
+		`// @inco: res == nil, -log, -onerror`:       EnsureOnError,
+		`// @inco: res != nil, -panic("x"), -ensure`: EnsureAlways,
+	} {
+		d := ParseDirective(input)
+		if d == nil || d.Ensure != want {
+			t.Errorf("ParseDirective(%q) = %+v, want Ensure %q", input, d, want)
+		}
+	}
+	for _, input := range []string{
+		`// @inco: res != nil, -return(nil), -onsuccess`, // control flow in a defer
+		`// @inco: x > 0, -continue, -ensure`,
+		`// @inco: res != nil, -onsuccess, -onerror`,
+		`// @inco: -valid v, -ensure`,
+		`// @inco: x > 0, -ensure(1)`,
+	} {
+		if d := ParseDirective(input); d != nil {
+			t.Errorf("ParseDirective(%q) = %+v, want nil", input, d)
+		}
+	}
+}
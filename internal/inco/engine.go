@@ -3,23 +3,31 @@
 package inco
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"go/ast"
-	"go/format"
 	"go/parser"
+	"go/scanner"
 	"go/token"
+	"go/types"
+	"io/fs"
+	"log/slog"
+	"maps"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
-
-	"golang.org/x/tools/go/ast/astutil"
+	"time"
 )
 
 // ---------------------------------------------------------------------------
@@ -28,24 +36,108 @@ import (
 
 // Engine scans Go source files for @inco: directives and produces an
 // overlay that injects the corresponding if-statements at compile time.
+//
+// Concurrency: Run, GenerateFile, Export and Result are safe to call from
+// multiple goroutines. Runs on the same Engine are serialized because they
+// share Root's .inco_cache, and runs in other processes on the same root
+// wait for each other on an advisory lock (see lock.go); Engines for
+// different roots share no mutable
+// state and run fully in parallel. Overlay and Stats are replaced as a
+// whole when a Run commits, so read them through Result while other
+// goroutines may be running. Config, Translators, Workers and the On*
+// callbacks must be set before the Engine is first used and not modified
+// afterwards. The callbacks run on worker goroutines, one at a time, so
+// they may stream results to an editor or progress bar during a Run.
 type Engine struct {
-	Root       string
-	Overlay    Overlay
-	importMap  map[string]string // lazily built: package name → import path
-	importOnce sync.Once
+	Root            string
+	Overlay         Overlay
+	Config          Config                // loaded from .inco.json; may be adjusted before Run
+	Stats           RunStats              // populated by Run
+	OnProgress      func(done, total int) // optional; called (serialized) after each file is handled
+	OnFileStart     func(path string)     // optional; called (serialized) before a file is hashed and processed
+	OnFileDone      func(FileEvent)       // optional; called (serialized) after each file is handled, before OnProgress
+	OnWarning       func(Diagnostic)      // optional; called (serialized) for each generation warning as its file is handled
+	Workers         int                   // files processed concurrently by Run; GOMAXPROCS when <= 0
+	Translators     map[string]Translator // -dsl translators registered by embedders
+	RunTranslators  bool                  // run the translator commands of .inco.json (see translate.go)
+	Buffers         map[string][]byte     // optional; unsaved contents of source files, by absolute path, read instead of the tree
+	LockTimeout     time.Duration         // how long Run waits for another process's cache lock; 30s when 0
+	ContinueOnError bool                  // skip files that fail instead of aborting Run (see RunReport)
+	Logger          *slog.Logger          // optional; receives the engine's log (see log.go), discarded when nil
+	Warm            bool                  // keep file hashes and imported types in memory between runs (see warm.go)
+	SharedCache     SharedCache           // optional; store of shadows shared between checkouts (see shared.go)
+	fsys            fs.FS                 // source tree under Root; nil reads the disk
+	configErr       error                 // deferred .inco.json load error, reported by Run
+	importMap       map[string]string     // lazily built: package name → import path
+	importOnce      sync.Once
+	runMu           sync.Mutex      // serializes Run: one writer of .inco_cache at a time
+	warnings        []Diagnostic    // warnings of the last completed Run
+	warm            warmState       // with Warm
+	resultImp       *exportImporter // importer of callResults; dropped by each Run
+	resultMu        sync.Mutex      // guards resultImp
+	mu              sync.RWMutex    // guards Overlay, Stats and warnings
 }
 
-// NewEngine creates an engine rooted at the given directory.
+// NewEngine creates an engine rooted at the given directory and loads the
+// project configuration from .inco.json, if present.
 func NewEngine(root string) *Engine {
 //line /Users/hitomikirigiri/Desktop/imnive/inco/internal/inco/engine.inco.go:38
 	if !(root != "") {
 		panic("NewEngine: root must not be empty")
 	}
 //line /Users/hitomikirigiri/Desktop/imnive/inco/internal/inco/engine.inco.go:39
+	cfg, err := LoadConfig(root)
+	return &Engine{
+		Root:      nativePath(root),
+		Overlay:   Overlay{Replace: make(map[string]string)},
+		Config:    cfg,
+		configErr: err,
+	}
+}
+
+// NewEngineFS creates an engine whose sources, configuration and ignore
+// files are read from fsys, e.g. an in-memory tree or a sandbox, instead
+// of from the disk. root names the tree: sources are identified by their
+// path under root in the overlay, messages and //line directives, and
+// .inco_cache is still written to root on disk.
+func NewEngineFS(root string, fsys fs.FS) *Engine {
+	_ = fsys // @inco: root != "" && fsys != nil, -panic("NewEngineFS: root and fsys must be set")
+	if !(root != "" && fsys != nil) {
+		panic("NewEngineFS: root and fsys must be set")
+	}
+	cfg, err := LoadConfigFS(fsys)
 	return &Engine{
-		Root:    root,
-		Overlay: Overlay{Replace: make(map[string]string)},
+		Root:      nativePath(root),
+		Overlay:   Overlay{Replace: make(map[string]string)},
+		Config:    cfg,
+		configErr: err,
+		fsys:      fsys,
+	}
+}
+
+// sourceFS returns the source tree under Root.
+func (e *Engine) sourceFS() fs.FS {
+	if e.fsys != nil {
+		return e.fsys
+	}
+	return os.DirFS(e.Root)
+}
+
+// readSource returns the content of the source file at path: its unsaved
+// buffer if there is one, or the file in the source tree.
+func (e *Engine) readSource(path string) ([]byte, error) {
+	if src, ok := e.Buffers[path]; ok {
+		return src, nil
+	}
+	if e.fsys == nil {
+		return os.ReadFile(path)
 	}
+	rel, err := filepath.Rel(e.Root, path)
+	_ = err // @inco: err == nil && filepath.IsLocal(rel), -return(nil, fmt.Errorf("%s is not under %s", path, e.Root))
+	if !(err == nil && filepath.IsLocal(rel)) {
+		return nil, fmt.Errorf("%s is not under %s", path, e.Root)
+	}
+	return fs.ReadFile(e.fsys, filepath.ToSlash(rel))
 }
 
 // ---------------------------------------------------------------------------
@@ -57,8 +149,14 @@ type fileResult struct {
 	Path       string
 	SrcHash    string
 	ShadowPath string
-	ShadowData []byte // nil when reused from cache
+	ShadowHash string    // SHA-256 hex of shadow content (cached results only)
+	ShadowData []byte    // nil when reused from cache
+	Lines      []linePos // positions of the lines of ShadowData, when generated by this run
+	Info       ShadowInfo
 	Cached     bool
+	Shared     bool  // fetched from Engine.SharedCache
+	Skipped    bool  // best-effort file that could not be parsed, a file over the limits, or a failed file; compiled as-is
+	Err        error // why the file failed, with ContinueOnError
 }
 
 // Run scans all Go source files under Root, processes @inco: directives,
@@ -67,36 +165,176 @@ type fileResult struct {
 // Incremental: if a source file's content hash matches the manifest and
 // the shadow file still exists, the file is skipped.
 //
-// File processing is parallelized across available CPUs.
+// File processing is parallelized across e.Workers goroutines, all
+// available CPUs by default. Results are committed to the overlay and
+// manifest in path order once every file is handled, so the output does
+// not depend on the worker count.
 func (e *Engine) Run() error {
+	return e.RunContext(context.Background())
+}
+
+// RunContext is Run with cancellation: the walk, file processing and
+// shadow writing stop once ctx is done, and RunContext returns ctx.Err().
+// The overlay and manifest of the previous run are left in place.
+func (e *Engine) RunContext(ctx context.Context) error {
+	_, err := e.RunReport(ctx)
+	return err
+}
+
+// RunReport is RunContext returning a Report of the run. Run itself prints
+// nothing; the CLI renders the report, and e.Logger receives the log.
+//
+// With e.ContinueOnError, a file that cannot be read, parsed, generated or
+// type-checked is skipped — compiled as-is — and the run goes on. The
+// overlay of the other files is committed, and RunReport returns it with
+// the errors.Join of the file errors.
+func (e *Engine) RunReport(ctx context.Context) (Report, error) {
+	report, err := e.runReport(ctx)
+	log := orDiscard(e.Logger)
+	if err != nil {
+		log.Error("run failed", "root", e.Root, "err", err)
+		return report, err
+	}
+	log.Info("run complete", "root", e.Root, "mapped", report.Mapped, "processed", report.Processed,
+		"cached", report.Cached, "warnings", len(report.Warnings), "duration", report.Duration)
+	return report, nil
+}
+
+// runReport implements RunReport.
+func (e *Engine) runReport(ctx context.Context) (Report, error) {
+	start := time.Now()
+	log := orDiscard(e.Logger)
 //line /Users/hitomikirigiri/Desktop/imnive/inco/internal/inco/engine.inco.go:66
 	if !(e != nil) {
-		return fmt.Errorf("Run: nil engine")
+		return Report{}, fmt.Errorf("Run: nil engine")
 	}
 //line /Users/hitomikirigiri/Desktop/imnive/inco/internal/inco/engine.inco.go:67
 	if !(e.Root != "") {
-		return fmt.Errorf("Run: root must not be empty")
+		return Report{}, fmt.Errorf("Run: root must not be empty")
 	}
 //line /Users/hitomikirigiri/Desktop/imnive/inco/internal/inco/engine.inco.go:68
+	if !(e.configErr == nil) {
+		return Report{}, e.configErr
+	}
+	e.runMu.Lock()
+	defer e.runMu.Unlock()
+	timeout := e.LockTimeout
+	if timeout == 0 {
+		timeout = defaultLockTimeout
+	}
+	unlock, err := lockCache(ctx, filepath.Join(e.Root, ".inco_cache"), timeout)
+	_ = err // @inco: err == nil, -return(Report{}, fmt.Errorf("Run: %w", err))
+	if !(err == nil) {
+		return Report{}, fmt.Errorf("Run: %w", err)
+	}
+	defer unlock()
+	e.resultMu.Lock()
+	e.resultImp = nil
+	e.resultMu.Unlock()
 
 	oldManifest := e.loadManifest()
+	configHash := e.Config.hash(e.Root)
+	if oldManifest.ConfigHash != configHash {
+		// Generation settings changed: no cached shadow can be reused.
+		oldManifest.Files = make(map[string]ManifestEntry)
+	}
+	filter, err := newPkgFilter(e.Config.Include, e.Config.Exclude)
+	_ = err // @inco: err == nil, -return(Report{}, fmt.Errorf("Run: %w", err))
+	if !(err == nil) {
+		return Report{}, fmt.Errorf("Run: %w", err)
+	}
+	filter.tests = e.Config.IncludeTests
+	filter.symlinks = e.Config.FollowSymlinks
 	oldOverlay := e.loadOverlayIfExists()
-	paths := collectGoFiles(e.Root)
+	paths, err := collectGoFiles(ctx, e.sourceFS(), e.Root, filter)
+	_ = err // @inco: err == nil, -return(Report{}, err)
+	if !(err == nil) {
+		return Report{}, err
+	}
 
 	// Process files concurrently.
 	results := make([]fileResult, len(paths))
-	workers := runtime.GOMAXPROCS(0)
+	workers := e.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
 	if workers > len(paths) {
 		workers = len(paths)
 	}
 
 	var wg sync.WaitGroup
 	var workerErr atomic.Value // stores first error from a worker
+	var eventMu sync.Mutex     // serializes the callbacks
+	done := 0
+	begin := func(path string) {
+		if e.OnFileStart == nil {
+			return
+		}
+		eventMu.Lock()
+		defer eventMu.Unlock()
+		e.OnFileStart(path)
+	}
+	finish := func(r fileResult) {
+		eventMu.Lock()
+		defer eventMu.Unlock()
+		done++
+		log.Debug("file", "path", r.Path, "directives", r.Info.Directives, "cached", r.Cached, "shared", r.Shared, "skipped", r.Skipped)
+		for _, w := range r.Info.Warnings {
+			logDiagnostic(log, slog.LevelWarn, w)
+			if e.OnWarning != nil {
+				e.OnWarning(w)
+			}
+		}
+		if e.OnFileDone != nil {
+			e.OnFileDone(FileEvent{Path: r.Path, Info: r.Info, Cached: r.Cached, Shared: r.Shared, Skipped: r.Skipped, Err: r.Err})
+		}
+		if e.OnProgress != nil {
+			e.OnProgress(done, len(paths))
+		}
+	}
 	ch := make(chan int, len(paths))
 	for i := range paths {
 		ch <- i
 	}
 	close(ch)
+	// fail records the error of the file at idx. With ContinueOnError the
+	// file is skipped and its worker goes on (true); otherwise the run
+	// stops with the first error.
+	fail := func(idx int, err error) bool {
+		if !e.ContinueOnError {
+			workerErr.CompareAndSwap(nil, err)
+			return false
+		}
+		results[idx] = fileResult{Path: paths[idx], Skipped: true, Err: err}
+		finish(results[idx])
+		return true
+	}
+	// skip compiles the file at idx as-is, with a warning saying why.
+	skip := func(idx int, msg string) {
+		w := Diagnostic{Path: paths[idx], Message: msg}
+		results[idx] = fileResult{Path: paths[idx], Skipped: true, Info: ShadowInfo{Warnings: []Diagnostic{w}}}
+		finish(results[idx])
+	}
+	fileTimeout := e.Config.fileTimeout()
+	var sharedPrefix string // "" when the shared cache is not used
+	if e.SharedCache != nil {
+		var ok bool
+		sharedPrefix, ok = e.sharedKeyPrefix(configHash)
+		if !ok {
+			orDiscard(e.Logger).Warn("shared cache not used: the generator has no version and its executable cannot be read")
+		}
+	}
+	// generate is generateShadowPos with its panics, the generation
+	// errors, returned.
+	generate := func(path string, f *ast.File, fset *token.FileSet) (data []byte, info ShadowInfo, pos []linePos, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("%v", r)
+			}
+		}()
+		data, info, pos = e.generateShadowPos(path, f, fset)
+		return data, info, pos, nil
+	}
 
 	for w := 0; w < workers; w++ {
 		wg.Add(1)
@@ -110,112 +348,429 @@ func (e *Engine) Run() error {
 			// Each goroutine gets its own fset to avoid contention.
 			fset := token.NewFileSet()
 			for idx := range ch {
+				if err := ctx.Err(); err != nil {
+					workerErr.CompareAndSwap(nil, err)
+					return
+				}
 				path := paths[idx]
-				srcHash, err := hashFile(path)
+				begin(path)
+				src, srcHash, err := e.hashSource(path)
 				if err != nil {
-					workerErr.CompareAndSwap(nil, err)
+					if fail(idx, fmt.Errorf("read %s: %w", path, err)) {
+						continue
+					}
 					return
 				}
 
 				// Check cache: source unchanged & shadow file exists → reuse.
-				if prev, ok := oldManifest.Files[path]; ok && prev.SrcHash == srcHash {
+				if prev, ok := oldManifest.Files[path]; ok && prev.SrcHash == srcHash && !prev.Typed {
 					if _, err := os.Stat(prev.ShadowPath); err == nil {
 						results[idx] = fileResult{
 							Path: path, SrcHash: srcHash,
-							ShadowPath: prev.ShadowPath, Cached: true,
+							ShadowPath: prev.ShadowPath, ShadowHash: prev.ShadowHash,
+							Info:   ShadowInfo{Directives: prev.Directives, Imports: prev.Imports, Package: prev.Package, Kinds: prev.Kinds, Warnings: prev.Warnings},
+							Cached: true,
 						}
+						finish(results[idx])
 						continue
 					}
 				}
 
-				// Cache miss — remove stale shadow before generating new one.
-				if old, ok := oldOverlay[path]; ok {
-					os.Remove(old)
+				if src == nil {
+					if src, err = e.readSource(path); err != nil {
+						if fail(idx, fmt.Errorf("read %s: %w", path, err)) {
+							continue
+						}
+						return
+					}
+				}
+				if limit := e.Config.MaxFileSize; limit > 0 && int64(len(src)) > limit {
+					skip(idx, fmt.Sprintf("file of %d bytes exceeds max_file_size (%d); compiled without checks", len(src), limit))
+					continue
+				}
+
+				var key string
+				if sharedPrefix != "" {
+					key = sharedKey(sharedPrefix, e.sharedPath(path), srcHash)
+					if shadowData, info, ok := e.fetchShared(ctx, key); ok {
+						for i := range info.Warnings {
+							info.Warnings[i].Path = path // stored by another checkout, with trim_path
+						}
+						results[idx] = fileResult{
+							Path: path, SrcHash: srcHash,
+							ShadowData: shadowData, Info: info, Shared: true,
+						}
+						finish(results[idx])
+						continue
+					}
 				}
 
 				// Parse and process.
-				f, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+				var (
+					parseErr   error
+					shadowData []byte
+					info       ShadowInfo
+					pos        []linePos
+				)
+				process := func() (err error) {
+					var f *ast.File
+					f, parseErr = parser.ParseFile(fset, path, src, parser.ParseComments)
+					if parseErr != nil {
+						return parseErr
+					}
+					shadowData, info, pos, err = generate(path, f, fset)
+					return err
+				}
+				err = runWithin(fileTimeout, process)
+				if errors.Is(err, errFileTimeout) {
+					skip(idx, fmt.Sprintf("processing exceeded file_timeout (%s); compiled without checks", fileTimeout))
+					continue
+				}
+				if parseErr != nil && e.isBestEffort(path) {
+					results[idx] = fileResult{Path: path, Skipped: true}
+					finish(results[idx])
+					continue
+				}
+				if parseErr != nil {
+					if fail(idx, fmt.Errorf("parse %s: %w", path, err)) {
+						continue
+					}
+					return
+				}
 				if err != nil {
-					workerErr.CompareAndSwap(nil, fmt.Errorf("parse %s: %w", path, err))
+					if fail(idx, err) {
+						continue
+					}
 					return
 				}
-				shadowData := e.generateShadow(path, f, fset)
+				if sharedPrefix != "" && !info.Typed {
+					e.storeShared(ctx, key, shadowData, info)
+				}
 				results[idx] = fileResult{
 					Path: path, SrcHash: srcHash,
-					ShadowData: shadowData,
+					ShadowData: shadowData, Lines: pos, Info: info,
 				}
+				finish(results[idx])
 			}
 		}()
 	}
 	wg.Wait()
 
 	if v := workerErr.Load(); v != nil {
-		return v.(error)
+		return Report{}, v.(error)
+	}
+	e.forgetRemoved(paths)
+	var warnings []Diagnostic
+	for _, r := range results {
+		warnings = append(warnings, r.Info.Warnings...)
+	}
+	if e.Config.Typecheck {
+		diags, notices, err := e.typecheckShadows(ctx, results)
+		_ = err // @inco: err == nil, -return(Report{}, err)
+		if !(err == nil) {
+			return Report{}, err
+		}
+		var errs []error
+		for _, d := range diags {
+			logDiagnostic(log, slog.LevelError, d)
+			if e.ContinueOnError && markFailed(results, d) {
+				continue
+			}
+			errs = append(errs, errors.New(d.String()))
+		}
+		_ = errs // @inco: len(errs) == 0, -return(Report{}, errors.Join(errs...))
+		if !(len(errs) == 0) {
+			return Report{}, errors.Join(errs...)
+		}
+		for _, d := range notices {
+			logDiagnostic(log, slog.LevelWarn, d)
+			if e.OnWarning != nil {
+				e.OnWarning(d)
+			}
+		}
+		warnings = append(warnings, notices...)
+	}
+	if e.Config.Strict && len(warnings) > 0 {
+		errs := []error{fmt.Errorf("Run: %d warning(s) in strict mode", len(warnings))}
+		for _, d := range warnings {
+			errs = append(errs, errors.New(d.String()))
+		}
+		return Report{}, errors.Join(errs...)
+	}
+	report, err := e.commitResults(ctx, results, oldOverlay, configHash)
+	_ = err // @inco: err == nil, -return(Report{}, err)
+	if !(err == nil) {
+		return Report{}, err
+	}
+	report.FilesScanned = len(paths)
+	report.Warnings = warnings
+	var fileErrs []error
+	for _, r := range results {
+		if r.Err != nil {
+			fileErrs = append(fileErrs, r.Err)
+		}
+	}
+	report.FilesFailed = len(fileErrs)
+	e.mu.Lock()
+	e.warnings = warnings
+	e.mu.Unlock()
+	for _, r := range results {
+		if r.Info.Directives > 0 {
+			report.FilesWithDirectives++
+		}
+		if r.Shared {
+			report.Shared++
+		}
+		for kind, n := range r.Info.Kinds {
+			if report.DirectivesByKind == nil {
+				report.DirectivesByKind = make(map[string]int)
+			}
+			report.DirectivesByKind[kind] += n
+		}
 	}
+	report.Duration = time.Since(start)
+	return report, errors.Join(fileErrs...)
+}
 
-	return e.commitResults(results, oldOverlay)
+// markFailed skips the file of the typecheck error d among results,
+// recording d as its error, and reports whether it was found.
+func markFailed(results []fileResult, d Diagnostic) bool {
+	for i, r := range results {
+		if r.Path != d.Path || r.ShadowData == nil {
+			continue
+		}
+		results[i] = fileResult{Path: r.Path, Skipped: true, Err: errors.New(d.String())}
+		return true
+	}
+	for i, r := range results {
+		if r.Path == d.Path && r.Err != nil {
+			results[i].Err = errors.Join(r.Err, errors.New(d.String()))
+			return true
+		}
+	}
+	return false
+}
+
+// GenerateFile processes a single source file and returns its shadow
+// content without touching the cache or the overlay. The file must be
+// inside e.Root, which anchors relative locations and configuration.
+func (e *Engine) GenerateFile(path string) (shadow []byte, err error) {
+	if !(e.configErr == nil) {
+		return nil, e.configErr
+	}
+	absPath, err := filepath.Abs(path)
+	_ = err // @inco: err == nil, -return(nil, fmt.Errorf("GenerateFile: %w", err))
+	if !(err == nil) {
+		return nil, fmt.Errorf("GenerateFile: %w", err)
+	}
+	src, err := e.readSource(absPath)
+	_ = err // @inco: err == nil, -return(nil, fmt.Errorf("GenerateFile: %w", err))
+	if !(err == nil) {
+		return nil, fmt.Errorf("GenerateFile: %w", err)
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, absPath, src, parser.ParseComments)
+	_ = err // @inco: err == nil, -return(nil, fmt.Errorf("parse %s: %w", absPath, err))
+	if !(err == nil) {
+		return nil, fmt.Errorf("parse %s: %w", absPath, err)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			shadow, err = nil, fmt.Errorf("%v", r)
+		}
+	}()
+	shadow, _ = e.generateShadow(absPath, f, fset)
+	return shadow, nil
 }
 
 // commitResults writes shadow files, builds overlay & manifest, and
-// cleans up stale shadows for deleted source files.
-func (e *Engine) commitResults(results []fileResult, oldOverlay map[string]string) error {
-	newManifest := &Manifest{Files: make(map[string]ManifestEntry)}
+// cleans up shadows that are no longer referenced (deleted or changed
+// source files).
+//
+// Shadows are content-addressed: byte-identical shadows produced for
+// different source files share a single file in .inco_cache.
+func (e *Engine) commitResults(ctx context.Context, results []fileResult, oldOverlay map[string]string, configHash string) (Report, error) {
+	ov := Overlay{Replace: make(map[string]string, len(results))}
+	newManifest := &Manifest{ConfigHash: configHash, Files: make(map[string]ManifestEntry)}
+	shared := make(map[string]string) // shadow content hash → shadow path
 	var skipped int
 	for _, r := range results {
 		if r.Cached {
-			e.Overlay.Replace[r.Path] = r.ShadowPath
-			newManifest.Files[r.Path] = ManifestEntry{SrcHash: r.SrcHash, ShadowPath: r.ShadowPath}
-			skipped++
-		} else {
-			err := e.writeShadow(r.Path, r.ShadowData)
-			_ = err // @inco: err == nil, -return(err)
-			if !(err == nil) {
-				return err
+			ov.Replace[r.Path] = r.ShadowPath
+			newManifest.Files[r.Path] = ManifestEntry{
+				SrcHash: r.SrcHash, ShadowPath: r.ShadowPath, ShadowHash: r.ShadowHash,
+				Directives: r.Info.Directives, Imports: r.Info.Imports, Package: r.Info.Package,
+				Kinds: r.Info.Kinds, Warnings: r.Info.Warnings,
 			}
-//line /Users/hitomikirigiri/Desktop/imnive/inco/internal/inco/engine.inco.go:159
-			if sp, ok := e.Overlay.Replace[r.Path]; ok {
-				newManifest.Files[r.Path] = ManifestEntry{SrcHash: r.SrcHash, ShadowPath: sp}
+			if r.ShadowHash != "" {
+				shared[r.ShadowHash] = r.ShadowPath
 			}
+			skipped++
+		}
+	}
+	reusable := len(shared) // shadows written by earlier runs
+	for _, r := range results {
+		if r.Cached || r.Skipped {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return Report{}, err
+		}
+		sp, shadowHash, err := e.writeShadow(r.Path, r.ShadowData, r.Lines, shared)
+		_ = err // @inco: err == nil, -return(Report{}, err)
+		if !(err == nil) {
+			return Report{}, err
+		}
+		ov.Replace[r.Path] = sp
+		newManifest.Files[r.Path] = ManifestEntry{
+			SrcHash: r.SrcHash, ShadowPath: sp, ShadowHash: shadowHash,
+			Directives: r.Info.Directives, Imports: r.Info.Imports, Package: r.Info.Package,
+			Kinds: r.Info.Kinds, Warnings: r.Info.Warnings, Typed: r.Info.Typed,
+		}
+	}
+	mapped := len(ov.Replace)
+	if e.Config.GateTag != "" {
+		err := e.writeGates(ov, results, shared)
+		_ = err // @inco: err == nil, -return(Report{}, err)
+		if !(err == nil) {
+			return Report{}, err
 		}
 	}
 
-	// Clean up shadows for source files that no longer exist.
-	for srcPath, shadowPath := range oldOverlay {
-		if _, ok := newManifest.Files[srcPath]; !ok {
+	// Clean up old shadows that no overlay entry references anymore.
+	live := make(map[string]bool, len(ov.Replace))
+	for _, sp := range ov.Replace {
+		live[sp] = true
+	}
+	for _, shadowPath := range oldOverlay {
+		if !live[shadowPath] {
 			os.Remove(shadowPath)
+			os.Remove(sourceMapPath(shadowPath))
 		}
 	}
 
-	err := e.writeOverlay()
-	_ = err // @inco: err == nil, -return(err)
+	err := e.writeOverlay(ov)
+	_ = err // @inco: err == nil, -return(Report{}, err)
 	if !(err == nil) {
-		return err
+		return Report{}, err
 	}
 //line /Users/hitomikirigiri/Desktop/imnive/inco/internal/inco/engine.inco.go:174
 	err = e.writeManifest(newManifest)
-	_ = err // @inco: err == nil, -return(err)
+	_ = err // @inco: err == nil, -return(Report{}, err)
 	if !(err == nil) {
-		return err
+		return Report{}, err
+	}
+	err = e.writeCompileDB(newManifest)
+	_ = err // @inco: err == nil, -return(Report{}, err)
+	if !(err == nil) {
+		return Report{}, err
 	}
 //line /Users/hitomikirigiri/Desktop/imnive/inco/internal/inco/engine.inco.go:176
 
-	if len(e.Overlay.Replace) > 0 {
-		processed := len(e.Overlay.Replace) - skipped
-		fmt.Fprintf(os.Stderr, "inco: overlay written to %s (%d file(s) mapped, %d processed, %d cached)\n",
-			filepath.Join(e.Root, ".inco_cache", "overlay.json"),
-			len(e.Overlay.Replace), processed, skipped)
+	stats := RunStats{
+		Mapped:    mapped,
+		Processed: mapped - skipped,
+		Cached:    skipped,
+	}
+	e.mu.Lock()
+	e.Overlay, e.Stats = ov, stats
+	e.mu.Unlock()
+	return Report{RunStats: stats, ShadowsWritten: len(shared) - reusable}, nil
+}
+
+// Gate files define GateConst for each package with guards, one per
+// build-tag polarity. They do not exist on disk; the overlay adds them.
+// External test packages get _test.go gates: the go command only accepts
+// a second package in a directory from test files.
+const (
+	gateOnFile      = "inco_checks_on.go"
+	gateOffFile     = "inco_checks_off.go"
+	gateOnTestFile  = "inco_checks_on_test.go"
+	gateOffTestFile = "inco_checks_off_test.go"
+)
+
+// gatePkg is a package that gets gate files.
+type gatePkg struct {
+	dir, name string
+}
+
+// writeGates adds the gate files of every package that has guards to ov
+// (see Config.GateTag).
+func (e *Engine) writeGates(ov Overlay, results []fileResult, shared map[string]string) error {
+	pkgs := make(map[gatePkg]bool)
+	for _, r := range results {
+		if r.Skipped || r.Info.Directives == 0 {
+			continue
+		}
+		pkgs[gatePkg{filepath.Dir(r.Path), r.Info.Package}] = true
+	}
+	for pkg := range pkgs {
+		files := map[string]bool{gateOnFile: true, gateOffFile: false}
+		if strings.HasSuffix(pkg.name, "_test") {
+			files = map[string]bool{gateOnTestFile: true, gateOffTestFile: false}
+		}
+		for name, on := range files {
+			path := filepath.Join(pkg.dir, name)
+			_, err := os.Stat(path)
+			_ = err // @inco: os.IsNotExist(err), -return(fmt.Errorf("gate_tag: %s already exists", path))
+			if !(os.IsNotExist(err)) {
+				return fmt.Errorf("gate_tag: %s already exists", path)
+			}
+			constraint := "!" + e.Config.GateTag
+			if !on {
+				constraint = e.Config.GateTag
+			}
+			src := fmt.Sprintf("// Code generated by inco. DO NOT EDIT.\n\n//go:build %s\n\npackage %s\n\nconst %s = %t\n",
+				constraint, pkg.name, GateConst, on)
+			sp, _, err := e.writeShadow(path, []byte(src), nil, shared)
+			_ = err // @inco: err == nil, -return(err)
+			if !(err == nil) {
+				return err
+			}
+			ov.Replace[path] = sp
+		}
 	}
 	return nil
 }
 
+// Result returns the overlay and statistics of the last completed Run.
+// Unlike reading the fields directly, it is safe while a Run is in
+// progress on another goroutine. The returned overlay is a copy.
+func (e *Engine) Result() (Overlay, RunStats) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	ov := Overlay{Replace: make(map[string]string, len(e.Overlay.Replace))}
+	for src, shadow := range e.Overlay.Replace {
+		ov.Replace[src] = shadow
+	}
+	return ov, e.Stats
+}
+
+// Diagnostics returns the warnings of the last completed Run: generation
+// warnings, malformed directives and typecheck notices, in path order.
+// Like Result, it is safe while a Run is in progress.
+func (e *Engine) Diagnostics() []Diagnostic {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return append([]Diagnostic(nil), e.warnings...)
+}
+
 // ---------------------------------------------------------------------------
 // File processing
 // ---------------------------------------------------------------------------
 
-// generateShadow produces the shadow file content for a source file.
+// generateShadow produces the shadow file content for a source file,
+// along with a summary of the injected code.
 // It is safe to call from multiple goroutines — it only reads e.Root
 // and uses the provided fset.
-func (e *Engine) generateShadow(path string, f *ast.File, fset *token.FileSet) []byte {
+func (e *Engine) generateShadow(path string, f *ast.File, fset *token.FileSet) ([]byte, ShadowInfo) {
+	content, info, _ := e.generateShadowPos(path, f, fset)
+	return content, info
+}
+
+// generateShadowPos is generateShadow also returning the source position
+// of each line of the shadow (see linemap.go).
+func (e *Engine) generateShadowPos(path string, f *ast.File, fset *token.FileSet) ([]byte, ShadowInfo, []linePos) {
 //line /Users/hitomikirigiri/Desktop/imnive/inco/internal/inco/engine.inco.go:194
 	if !(path != "") {
 		panic("generateShadow: empty path")
@@ -225,134 +780,1637 @@ func (e *Engine) generateShadow(path string, f *ast.File, fset *token.FileSet) [
 		panic("generateShadow: nil AST")
 	}
 //line /Users/hitomikirigiri/Desktop/imnive/inco/internal/inco/engine.inco.go:196
-	// 1. Collect directive lines from AST comments.
+	bestEffort := e.isBestEffort(path)
+	pragmas, err := collectPragmas(f, fset)
+	_ = err // @inco: err == nil || bestEffort, -panic(fmt.Errorf("%s:%w", path, err))
+	if !(err == nil || bestEffort) {
+		panic(fmt.Errorf("%s:%w", path, err))
+	}
+
+	// With Config.ExportedOnly, everything inside unexported functions is
+	// dropped with a warning; with Config.Funcs, everything inside
+	// functions whose names do not match, silently.
+	var warnings []Diagnostic
+	funcs := collectFuncDecls(f, fset)
+	targets, err := compileFuncPatterns(e.Config.Funcs)
+	_ = err // @inco: err == nil, -panic(err)
+	if !(err == nil) {
+		panic(err)
+	}
+	ignored := func(line int, what string) bool {
+		for _, fd := range funcs {
+			if line < fd.start || line > fd.end {
+				continue
+			}
+			if e.Config.ExportedOnly && !fd.exported {
+				warnings = append(warnings, Diagnostic{path, line, fmt.Sprintf("%s in unexported function %s ignored (exported_only)", what, fd.name)})
+				return true
+			}
+			return targets != nil && !targets.MatchString(fd.name)
+		}
+		return false
+	}
+
+	// 1. Collect directive lines from AST comments, skipping regions
+	// turned off by //inco:disable.
 	directives := make(map[int]*Directive) // 1-based line → Directive
 	for _, cg := range f.Comments {
 		for _, c := range cg.List {
-			d := ParseDirective(c.Text)
-			_ = d // @inco: d != nil, -continue
-			if !(d != nil) {
+			text, err := e.expandMacros(c.Text)
+			if err != nil && bestEffort {
+				continue
+			}
+			_ = err // @inco: err == nil, -panic(fmt.Errorf("%s:%d: %w", path, fset.Position(c.Pos()).Line, err))
+			if !(err == nil) {
+				panic(fmt.Errorf("%s:%d: %w", path, fset.Position(c.Pos()).Line, err))
+			}
+			d := pragmas.parse(text)
+			if d == nil && strings.HasPrefix(stripComment(text), "@inco") {
+				// Looks like a directive but does not parse: say so
+				// rather than compile the file without it.
+				line := fset.Position(c.Pos()).Line
+				if pragmas.enabled(line) {
+					msg := fmt.Sprintf("malformed directive ignored: %s", stripComment(text))
+					if problem := directiveProblem(stripComment(text)); problem != "" {
+						msg += " (" + problem + ")"
+					}
+					warnings = append(warnings, Diagnostic{path, line, msg})
+				}
+				continue
+			}
+			if d == nil {
+				if msg := misspelling(text); msg != "" && pragmas.enabled(fset.Position(c.Pos()).Line) {
+					warnings = append(warnings, Diagnostic{path, fset.Position(c.Pos()).Line, msg})
+				}
+				continue
+			}
+			_ = d // @inco: d != nil && e.Config.enabled(d), -continue
+			if !(d != nil && e.Config.enabled(d)) {
 				continue
 			}
 //line /Users/hitomikirigiri/Desktop/imnive/inco/internal/inco/engine.inco.go:202
 			line := fset.Position(c.Pos()).Line
+			if !pragmas.enabled(line) || ignored(line, "directive") {
+				continue
+			}
+			if d.Flag == "dsl" {
+				err := e.translateDSL(d)
+				if err != nil && bestEffort {
+					continue
+				}
+				_ = err // @inco: err == nil, -panic(fmt.Errorf("%s:%d: %w", path, line, err))
+				if !(err == nil) {
+					panic(fmt.Errorf("%s:%d: %w", path, line, err))
+				}
+			}
+			if name, text := strayOption(d.Expr); name != "" && !optionNameRe.MatchString(name) {
+				warnings = append(warnings, Diagnostic{path, line, unknownOption(name)})
+			} else if name != "" {
+				warnings = append(warnings, Diagnostic{path, line, fmt.Sprintf("option %s does not parse", text)})
+			} else if _, err := parser.ParseExpr(d.Expr); err != nil {
+				warnings = append(warnings, Diagnostic{path, line, fmt.Sprintf("condition %q is not a Go expression: %v", d.Expr, err)})
+			}
 			directives[line] = d
 		}
 	}
 
 	// 2. Read source as lines.
-	src, err := os.ReadFile(path)
+	src, err := e.readSource(path)
 	_ = err // @inco: err == nil, -panic(err)
 	if !(err == nil) {
 		panic(err)
 	}
 //line /Users/hitomikirigiri/Desktop/imnive/inco/internal/inco/engine.inco.go:210
+	// Lines are handled without their carriage returns, which the
+	// compiler ignores; the shadow gets them back when rendered.
 	lines := strings.Split(string(src), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
 
 	// 3. Classify directives as standalone or inline using AST.
+	// Directives outside function bodies check package-level state and
+	// run from a generated init function.
 	standalone := make(map[int]*Directive)
 	inline := make(map[int]*Directive)
+	pkgLevel := make(map[int]*Directive)
+	kinds := make(map[string]int)
 
 	stmtLines := collectStmtLines(f, fset)
+	funcBodies := collectFuncBodies(f, fset)
+	spans := collectFuncs(f, fset)
+	var contracts []Contract
+	varLines := collectPackageVars(f, fset)
+	off := e.disabledKinds(path)
 	for lineNum, d := range directives {
 		idx := lineNum - 1
 //line /Users/hitomikirigiri/Desktop/imnive/inco/internal/inco/engine.inco.go:219
 		if !(idx >= 0 && idx < len(lines)) {
 			continue
 		}
-//line /Users/hitomikirigiri/Desktop/imnive/inco/internal/inco/engine.inco.go:220
-		trimmed := strings.TrimSpace(lines[idx])
-		isCommentLine := strings.HasPrefix(trimmed, "//") || strings.HasPrefix(trimmed, "/*")
-		if isCommentLine {
-			standalone[lineNum] = d
-		} else if stmtLines[lineNum] {
-			inline[lineNum] = d
+//line /Users/hitomikirigiri/Desktop/imnive/inco/internal/inco/engine.inco.go:220
+		trimmed := strings.TrimSpace(lines[idx])
+		isCommentLine := strings.HasPrefix(trimmed, "//") || strings.HasPrefix(trimmed, "/*")
+		kind := KindRequire
+		switch {
+		case d.Ensure != "":
+			kind = KindEnsure
+		case !isCommentLine:
+			kind = KindMust
+		}
+		if off[d.Action.String()] || off[kind] {
+			// Turned off for this package by Config.Disable.
+			continue
+		}
+		inBody := false
+		for _, r := range funcBodies {
+			inBody = inBody || (lineNum >= r.start && lineNum <= r.end)
+		}
+		switch {
+		case !inBody && (isCommentLine || varLines[lineNum]):
+			pkgLevel[lineNum] = d
+			kinds[kind]++
+			contracts = append(contracts, newContract(f, spans, d, lineNum, kind))
+		case !inBody:
+			// After an import, a type, a field or a function signature:
+			// nothing there to check.
+			warnings = append(warnings, Diagnostic{path, lineNum, fmt.Sprintf("orphaned directive ignored: %s (not on its own line or after a package-level var)", d.Expr)})
+		case isCommentLine:
+			standalone[lineNum] = d
+			kinds[kind]++
+			contracts = append(contracts, newContract(f, spans, d, lineNum, kind))
+		case stmtLines[lineNum]:
+			inline[lineNum] = d
+			kinds[kind]++
+			contracts = append(contracts, newContract(f, spans, d, lineNum, kind))
+		default:
+			// On the line a function opens, inside an expression, or after
+			// a closing brace.
+			warnings = append(warnings, Diagnostic{path, lineNum, fmt.Sprintf("orphaned directive ignored: %s (not on its own line or after a statement)", d.Expr)})
+		}
+	}
+	results, discardWarnings := e.collectDiscarded(path, f, fset, lines, inline)
+	warnings = append(warnings, discardWarnings...)
+	checks := maps.Clone(standalone)
+	maps.Copy(checks, inline)
+	// A directive bound to the error its statement discards checks a
+	// variable of its own.
+	maps.DeleteFunc(checks, func(line int, _ *Directive) bool {
+		_, bound := results[line]
+		return bound
+	})
+	warnings = append(warnings, redundantDirectives(path, f, fset, checks)...)
+
+	// Optionally merge runs of entry preconditions into one branch.
+	var prologues map[int][]int
+	grouped := make(map[int]bool)
+	if e.Config.GroupPrologue {
+		prologues = collectPrologues(f, fset, standalone)
+		for _, group := range prologues {
+			for _, ln := range group {
+				grouped[ln] = true
+			}
+		}
+	}
+
+	// 4. Build output.
+	g := newShadowGen(path, e.lineName(path))
+	g.pkg = f.Name.Name
+	g.inline = inline
+	g.funcs = spans
+	g.ctxs = collectCtxParams(f, fset)
+	g.errs = collectErrResults(f, fset)
+	g.labels = collectLabels(f, fset)
+	g.retries = collectRetries(f, fset, src, inline)
+	g.results = results
+	inits := collectInits(f, fset, lines, inline)
+	bodies := collectLoopBodies(f, fset)
+	w := newShadowWriter(g.file, importsEnd(f, fset))
+	w.crlf = usesCRLF(src)
+	// A shadow without //line directives is named by its own path, in the
+	// cache, which -trimpath does not turn into the source's.
+	w.named = e.Config.TrimPath
+	closers := make(map[int][]string) // line → indents of blocks closed after it
+	pending := make(map[int][]func()) // line → guards emitted after it
+	emitAfter := func(at int, emit func()) {
+		pending[at] = append(pending[at], emit)
+	}
+	annotations := 0
+	for _, fa := range collectAnnotations(f, fset, func(line int) bool {
+		return pragmas.enabled(line) && !ignored(line, "annotation")
+	}) {
+		if block, ok := e.generateAnnotations(g, fa, bestEffort); ok {
+			emitAfter(fa.lbrace, func() { w.inject(fa.lbrace, block) })
+			annotations += len(fa.anns)
+			kinds[KindAnnotation] += len(fa.anns)
+		}
+	}
+	// Sidecar contracts follow the annotations, so @trace covers them.
+	sidecar := 0
+	for _, sc := range e.collectSidecar(path, f, fset, pragmas, func(line int) bool {
+		return pragmas.enabled(line) && !ignored(line, "sidecar contract")
+	}, bestEffort) {
+		kind := KindRequire
+		if sc.d.Ensure != "" {
+			kind = KindEnsure
+		}
+		if off[sc.d.Action.String()] || off[kind] {
+			continue
+		}
+		if block, ok := e.tryIfBlock(g, sc.d, "\t", sc.lbrace, bestEffort); ok {
+			emitAfter(sc.lbrace, func() { w.inject(sc.lbrace, block) })
+			sidecar++
+			kinds[kind]++
+			contracts = append(contracts, newContract(f, spans, sc.d, sc.lbrace, kind))
+		}
+	}
+	for idx, line := range lines {
+		lineNum := idx + 1
+
+		if group, ok := prologues[lineNum]; ok {
+			w.inject(lineNum, e.generatePrologue(g, standalone, group, extractIndent(line)))
+		} else if grouped[lineNum] {
+			// Emitted as part of its prologue.
+		} else if d, ok := standalone[lineNum]; ok {
+			if block, ok := e.tryIfBlock(g, d, extractIndent(line), lineNum, bestEffort); ok {
+				w.inject(lineNum, block)
+			} else {
+				w.copy(lineNum, line)
+			}
+		} else if sp, ok := inits[lineNum]; ok {
+			// Hoist the init into its own block so the guard runs before the
+			// if/switch evaluates its condition. The init keeps its line.
+			indent := extractIndent(line)
+			w.inject(lineNum, sp.prefix+"{")
+			w.copy(lineNum, indent+"\t"+sp.init)
+			if block, ok := e.tryIfBlock(g, inline[lineNum], indent+"\t", lineNum, bestEffort); ok {
+				w.follow(lineNum, block)
+			}
+			w.copy(lineNum, indent+"\t"+sp.header)
+			closers[sp.end] = append([]string{indent}, closers[sp.end]...)
+		} else if d, ok := inline[lineNum]; ok {
+			block, ok := e.tryIfBlock(g, d, extractIndent(line), lineNum, bestEffort)
+			_, bound := g.results[lineNum]
+			if !(ok && bound) {
+				// Unless the guard binds the statement's result itself, the
+				// statement stays and the guard follows it.
+				w.copy(lineNum, line)
+			}
+			if at, isLoop := bodies[lineNum]; ok && isLoop && at != lineNum {
+				// Multi-line loop header: the guard opens the body.
+				emitAfter(at, func() { w.follow(lineNum, block) })
+			} else if ok && bound {
+				w.inject(lineNum, block)
+			} else if ok {
+				w.follow(lineNum, block)
+			}
+		} else {
+			w.copy(lineNum, line)
+		}
+		for _, emit := range pending[lineNum] {
+			emit()
+		}
+		for _, indent := range closers[lineNum] {
+			w.follow(lineNum, indent+"}")
+		}
+	}
+
+	// 5. Append hoisted declarations and add missing imports.
+	if len(pkgLevel) > 0 {
+		g.decls = append(g.decls, e.generatePackageInit(g, pkgLevel, bestEffort))
+	}
+	g.finish()
+	if len(g.decls) > 0 {
+		w.appendDecls(g.decls)
+	}
+	pkgs, _ := w.format()
+	added := e.missingImports(f, directives, g.imports, pkgs)
+	w.imports = added
+	w.aliased = g.reservedImportsFor(f)
+	if len(w.aliased) > 0 {
+		added = slices.Compact(slices.Sorted(slices.Values(slices.Concat(added, w.aliased))))
+	}
+	content, pos := w.render()
+
+	if len(kinds) == 0 {
+		kinds = nil
+	}
+	sort.SliceStable(warnings, func(i, j int) bool { return warnings[i].Line < warnings[j].Line })
+	sort.SliceStable(contracts, func(i, j int) bool { return contracts[i].Line < contracts[j].Line })
+	info := ShadowInfo{
+		Directives: len(standalone) + len(inline) + len(pkgLevel) + annotations + sidecar,
+		Imports:    added, Package: f.Name.Name, Kinds: kinds, Warnings: warnings,
+		Contracts: contracts, Typed: results != nil,
+	}
+	return []byte(content), info, pos
+}
+
+// ---------------------------------------------------------------------------
+// Code generation
+// ---------------------------------------------------------------------------
+
+// shadowGen accumulates per-file state while a shadow is generated:
+// package-level declarations hoisted out of guards and the import paths
+// the generated code needs.
+type shadowGen struct {
+	path    string
+	file    string             // path as //line directives name it
+	id      string             // short hash of path; keeps generated names unique per package
+	decls   []string           // package-level declarations appended to the shadow
+	imports []string           // import paths required by generated code
+	aliased []string           // the same, imported under their reserved names (see reservedImports)
+	regexps map[string]string  // regexp literal → hoisted var name
+	locs    []string           // location table entries ("file:line")
+	locIdx  map[int]int        // source line → index into locs
+	pkg     string             // package name, for message templates
+	funcs   []funcRange        // top-level functions, for message templates
+	retries map[int]string     // line → re-assignment text for -retry
+	results map[int]boundCall  // line → call whose discarded error the directive checks
+	inline  map[int]*Directive // directives attached to statements, by line
+	ctxs    []funcRange        // functions whose first parameter is a context.Context, named by that parameter
+	errs    []funcRange        // every function, named by its error result ("" when it has no named one)
+	sites   int                // per-site state vars hoisted so far (-logonce, -logevery, prologues)
+	traced  []funcRange        // @trace functions, named by their context parameter
+	labels  []labelRange       // labeled statements, for -break(label) and -continue(label)
+}
+
+// funcRange is the line span of a top-level function or method.
+type funcRange struct {
+	name       string // "F" or "T.M"
+	start, end int
+}
+
+// collectFuncs records the line span of every function declaration in f.
+// Closures report the function that contains them.
+func collectFuncs(f *ast.File, fset *token.FileSet) []funcRange {
+	var out []funcRange
+	for _, decl := range f.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		name := fn.Name.Name
+		if fn.Recv != nil && len(fn.Recv.List) > 0 {
+			name = recvTypeName(fn.Recv.List[0].Type) + "." + name
+		}
+		out = append(out, funcRange{name, fset.Position(fn.Pos()).Line, fset.Position(fn.End()).Line})
+	}
+	return out
+}
+
+// funcAt returns the name of the function enclosing line, or "" at package
+// level.
+func (g *shadowGen) funcAt(line int) string {
+	for _, fr := range g.funcs {
+		if line >= fr.start && line <= fr.end {
+			return fr.name
+		}
+	}
+	return ""
+}
+
+// collectCtxParams records, for every function or closure whose first
+// parameter is a named context.Context, that parameter's name and the
+// function's line span.
+func collectCtxParams(f *ast.File, fset *token.FileSet) []funcRange {
+	var out []funcRange
+	ast.Inspect(f, func(n ast.Node) bool {
+		var ft *ast.FuncType
+		switch fn := n.(type) {
+		case *ast.FuncDecl:
+			ft = fn.Type
+		case *ast.FuncLit:
+			ft = fn.Type
+		default:
+			return true
+		}
+		if ft.Params == nil || len(ft.Params.List) == 0 {
+			return true
+		}
+		first := ft.Params.List[0]
+		sel, ok := first.Type.(*ast.SelectorExpr)
+		if !(ok && len(first.Names) > 0 && first.Names[0].Name != "_" && sel.Sel.Name == "Context") {
+			return true
+		}
+		if pkg, ok := sel.X.(*ast.Ident); ok && pkg.Name == "context" {
+			out = append(out, funcRange{first.Names[0].Name, fset.Position(n.Pos()).Line, fset.Position(n.End()).Line})
+		}
+		return true
+	})
+	return out
+}
+
+// ctxAt returns the context parameter of the innermost function enclosing
+// line that takes one — closures capture their outer function's context —
+// or "" when there is none.
+func (g *shadowGen) ctxAt(line int) string {
+	ctx, span := "", -1
+	for _, fr := range g.ctxs {
+		if line >= fr.start && line <= fr.end && (span < 0 || fr.end-fr.start < span) {
+			ctx, span = fr.name, fr.end-fr.start
+		}
+	}
+	return ctx
+}
+
+// collectErrResults records the line span of every function and closure,
+// named by its last result when that is a named error.
+func collectErrResults(f *ast.File, fset *token.FileSet) []funcRange {
+	var out []funcRange
+	ast.Inspect(f, func(n ast.Node) bool {
+		var ft *ast.FuncType
+		switch fn := n.(type) {
+		case *ast.FuncDecl:
+			ft = fn.Type
+		case *ast.FuncLit:
+			ft = fn.Type
+		default:
+			return true
+		}
+		name := ""
+		if ft.Results != nil && len(ft.Results.List) > 0 {
+			last := ft.Results.List[len(ft.Results.List)-1]
+			if id, ok := last.Type.(*ast.Ident); ok && id.Name == "error" && len(last.Names) > 0 {
+				name = last.Names[len(last.Names)-1].Name
+			}
+		}
+		out = append(out, funcRange{name, fset.Position(n.Pos()).Line, fset.Position(n.End()).Line})
+		return true
+	})
+	return out
+}
+
+// errResultAt returns the named error result of the innermost function
+// enclosing line, or "" when that function has none.
+func (g *shadowGen) errResultAt(line int) string {
+	name, span := "", -1
+	for _, fr := range g.errs {
+		if line >= fr.start && line <= fr.end && (span < 0 || fr.end-fr.start < span) {
+			name, span = fr.name, fr.end-fr.start
+		}
+	}
+	return name
+}
+
+// labelRange is the body span of a labeled statement, excluding the lines
+// of its braces: the lines from which the label can be targeted.
+type labelRange struct {
+	funcRange      // named by the label
+	loop      bool // a for or range loop, which continue can target too
+}
+
+// collectLabels records every labeled for, range, switch and select
+// statement.
+func collectLabels(f *ast.File, fset *token.FileSet) []labelRange {
+	var out []labelRange
+	ast.Inspect(f, func(n ast.Node) bool {
+		ls, ok := n.(*ast.LabeledStmt)
+		if !ok {
+			return true
+		}
+		var body *ast.BlockStmt
+		loop := false
+		switch s := ls.Stmt.(type) {
+		case *ast.ForStmt:
+			body, loop = s.Body, true
+		case *ast.RangeStmt:
+			body, loop = s.Body, true
+		case *ast.SwitchStmt:
+			body = s.Body
+		case *ast.TypeSwitchStmt:
+			body = s.Body
+		case *ast.SelectStmt:
+			body = s.Body
+		default:
+			return true
+		}
+		start, end := fset.Position(body.Lbrace).Line+1, fset.Position(body.Rbrace).Line-1
+		out = append(out, labelRange{funcRange{ls.Label.Name, start, end}, loop})
+		return true
+	})
+	return out
+}
+
+// hasLabel reports whether a guard at line can break to label, or with
+// loop set, continue it: line is in the body of a statement so labeled,
+// within the same function.
+func (g *shadowGen) hasLabel(line int, label string, loop bool) bool {
+	fn, span := 0, -1
+	for _, fr := range g.errs {
+		if line >= fr.start && line <= fr.end && (span < 0 || fr.end-fr.start < span) {
+			fn, span = fr.start, fr.end-fr.start
+		}
+	}
+	for _, lr := range g.labels {
+		if lr.name == label && line >= lr.start && line <= lr.end && lr.start > fn && (lr.loop || !loop) {
+			return true
+		}
+	}
+	return false
+}
+
+// newShadowGen returns the generator of the shadow of the source at
+// path, named file by its //line directives.
+func newShadowGen(path, file string) *shadowGen {
+	h := sha256.Sum256([]byte(file))
+	return &shadowGen{
+		path:    path,
+		file:    file,
+		id:      fmt.Sprintf("%x", h[:4]),
+		regexps: make(map[string]string),
+		locIdx:  make(map[int]int),
+	}
+}
+
+// locTableName is the name of the per-file location table var.
+func (g *shadowGen) locTableName() string {
+	return "_incoLoc_" + g.id
+}
+
+// locRef returns an expression referencing the location table entry for
+// loc (recorded under line), adding the entry on first use.
+func (g *shadowGen) locRef(line int, loc string) string {
+	idx, ok := g.locIdx[line]
+	if !ok {
+		idx = len(g.locs)
+		g.locs = append(g.locs, loc)
+		g.locIdx[line] = idx
+	}
+	return fmt.Sprintf("%s[%d]", g.locTableName(), idx)
+}
+
+// finish appends declarations that depend on the whole file, such as the
+// location table.
+func (g *shadowGen) finish() {
+	if len(g.locs) == 0 {
+		return
+	}
+	entries := make([]string, len(g.locs))
+	for i, loc := range g.locs {
+		entries[i] = fmt.Sprintf("\t%q,", loc)
+	}
+	g.decls = append(g.decls, fmt.Sprintf("var %s = [...]string{\n%s\n}", g.locTableName(), strings.Join(entries, "\n")))
+}
+
+// addImport records an import path required by generated code.
+func (g *shadowGen) addImport(path string) {
+	imports := &g.imports
+	if reservedImports[path] != "" {
+		imports = &g.aliased
+	}
+	if !slices.Contains(*imports, path) {
+		*imports = append(*imports, path)
+	}
+}
+
+// reservedImports are the names generated code imports packages under
+// where the name the file gives them, if any, cannot be relied on: the
+// file may import the package under another name, or use its name for
+// something else.
+var reservedImports = map[string]string{
+	"regexp": "_incoRegexp",
+}
+
+// reservedImportsFor returns the paths among g.aliased that the file f
+// does not already import under their reserved name.
+func (g *shadowGen) reservedImportsFor(f *ast.File) []string {
+	var paths []string
+	for _, path := range g.aliased {
+		imported := false
+		for _, imp := range f.Imports {
+			if imp.Name != nil && imp.Name.Name == reservedImports[path] && strings.Trim(imp.Path.Value, `"`) == path {
+				imported = true
+			}
+		}
+		if !imported {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// mustCompileRe matches regexp.MustCompile calls with a literal pattern,
+// as emitted by the -match flag.
+var mustCompileRe = regexp.MustCompile("regexp\\.MustCompile\\((`[^`]*`|\"(?:[^\"\\\\]|\\\\.)*\")\\)")
+
+// hoistRegexps replaces regexp.MustCompile(lit) calls in expr with
+// package-level vars so each pattern is compiled once, at init. The vars
+// import regexp under its reserved name (see reservedImports).
+func (g *shadowGen) hoistRegexps(expr string) string {
+	return mustCompileRe.ReplaceAllStringFunc(expr, func(call string) string {
+		lit := mustCompileRe.FindStringSubmatch(call)[1]
+		if name, ok := g.regexps[lit]; ok {
+			return name
+		}
+		name := fmt.Sprintf("_incoRe_%s_%d", g.id, len(g.regexps))
+		g.regexps[lit] = name
+		g.decls = append(g.decls, fmt.Sprintf("var %s = %s.MustCompile(%s)", name, reservedImports["regexp"], lit))
+		g.addImport("regexp")
+		return name
+	})
+}
+
+// guardExpr returns the condition to emit for d: the flag-resolved
+// expression, extended by any -except sentinels.
+func (e *Engine) guardExpr(g *shadowGen, d *Directive, line int) string {
+	expr := e.flagExpr(g, d, line)
+	if len(d.Except) == 0 {
+		return expr
+	}
+	g.addImport("errors")
+	ev := errVars(d.Expr)[0]
+	terms := []string{"(" + expr + ")"}
+	for _, sentinel := range d.Except {
+		terms = append(terms, fmt.Sprintf("errors.Is(%s, %s)", ev, sentinel))
+	}
+	return strings.Join(terms, " || ")
+}
+
+// flagExpr resolves flags that depend on the shadow (hoisted regexps) or
+// on the configuration (named predicates). An unknown predicate panics;
+// Run reports it as an error.
+func (e *Engine) flagExpr(g *shadowGen, d *Directive, line int) string {
+	switch d.Flag {
+	case "match":
+		return g.hoistRegexps(d.Expr)
+	case "valid":
+		return "err == nil"
+	case "nd":
+		g.addImport("reflect")
+		return d.Expr
+	case "is":
+		name := d.FlagArgs[0]
+		pred, ok := e.Config.Predicates[name]
+		_ = ok // @inco: ok, -panic(fmt.Errorf("%s:%d: unknown predicate %q%s", g.path, line, name, didYouMean("", name, slices.Sorted(maps.Keys(e.Config.Predicates)))))
+		if !(ok) {
+			panic(fmt.Errorf("%s:%d: unknown predicate %q%s", g.path, line, name, didYouMean("", name, slices.Sorted(maps.Keys(e.Config.Predicates)))))
+		}
+		expr := joinPerVar(d.FlagVars, func(v string) string {
+			return strings.ReplaceAll(pred.Expr, "%s", v)
+		})
+		_, err := parser.ParseExpr(expr)
+		_ = err // @inco: err == nil, -panic(fmt.Errorf("%s:%d: predicate %q: %w", g.path, line, name, err))
+		if !(err == nil) {
+			panic(fmt.Errorf("%s:%d: predicate %q: %w", g.path, line, name, err))
+		}
+		if pred.Import != "" {
+			g.addImport(pred.Import)
+		}
+		return expr
+	}
+	return d.Expr
+}
+
+// validateCall returns the configured validator call for a -valid
+// directive and records its import.
+func (e *Engine) validateCall(g *shadowGen, d *Directive, line int) string {
+	v := e.Config.validator()
+	call := strings.ReplaceAll(v.Expr, "%s", d.FlagVars[0])
+	_, err := parser.ParseExpr(call)
+	_ = err // @inco: err == nil, -panic(fmt.Errorf("%s:%d: validator: %w", g.path, line, err))
+	if !(err == nil) {
+		panic(fmt.Errorf("%s:%d: validator: %w", g.path, line, err))
+	}
+	if v.Import != "" {
+		g.addImport(v.Import)
+	}
+	return call
+}
+
+// collectRetries returns, for every inline -retry directive attached to
+// an assignment, the statement re-written as a plain assignment
+// ("a, err = call()") so the generator can repeat it.
+func collectRetries(f *ast.File, fset *token.FileSet, src []byte, inline map[int]*Directive) map[int]string {
+	out := make(map[int]string)
+	ast.Inspect(f, func(n ast.Node) bool {
+		as, ok := n.(*ast.AssignStmt)
+		if !(ok && (as.Tok == token.DEFINE || as.Tok == token.ASSIGN)) {
+			return true
+		}
+		line := fset.Position(as.Pos()).Line
+		if d, ok := inline[line]; !(ok && d.Retry != nil) {
+			return true
+		}
+		text := func(from, to token.Pos) string {
+			return string(src[fset.Position(from).Offset:fset.Position(to).Offset])
+		}
+		out[line] = text(as.Lhs[0].Pos(), as.Lhs[len(as.Lhs)-1].End()) + " = " +
+			text(as.Rhs[0].Pos(), as.Rhs[len(as.Rhs)-1].End())
+		return true
+	})
+	return out
+}
+
+// collectDiscarded returns, for every inline directive attached to a
+// statement that discards a call's error — "w.Close()" or "_ = w.Close()"
+// — the call and how the guard that replaces the statement binds its
+// result, in its init. The error gets a name of its own, so the directive
+// does not check another variable of the same name:
+//
+//	w.Close() // @inco: err == nil, -return(err)
+//	→ if _incoErr := w.Close(); !(_incoErr == nil) { return _incoErr }
+//
+// Only statements alone on their line are rewritten, and only when the
+// condition requires an error to be nil and the call is known, from the
+// package's types, to return a single error. A condition requiring
+// several errors to be nil binds the error results the callee names so,
+// in any order, and discards the others:
+//
+//	closeBoth() // @inco: errB == nil && errA == nil
+//	→ if _, _incoErr1, _incoErr2 := closeBoth(); !(_incoErr2 == nil && _incoErr1 == nil) { ... }
+//
+// where closeBoth returns (n int, errA, errB error). Other statements are
+// left as they are, with the guard after them, and a warning. As another
+// file may change the call's type, a shadow with such statements is
+// regenerated on every run.
+func (e *Engine) collectDiscarded(path string, f *ast.File, fset *token.FileSet, lines []string, inline map[int]*Directive) (map[int]boundCall, []Diagnostic) {
+	type discard struct {
+		line int
+		call *ast.CallExpr
+		text string
+		ev   []string
+	}
+	var found []discard
+	ast.Inspect(f, func(n ast.Node) bool {
+		var call *ast.CallExpr
+		switch s := n.(type) {
+		case *ast.ExprStmt:
+			call, _ = s.X.(*ast.CallExpr)
+		case *ast.AssignStmt:
+			if len(s.Lhs) == 1 && len(s.Rhs) == 1 && s.Tok == token.ASSIGN {
+				if id, ok := s.Lhs[0].(*ast.Ident); ok && id.Name == "_" {
+					call, _ = s.Rhs[0].(*ast.CallExpr)
+				}
+			}
+		}
+		if call == nil {
+			return true
+		}
+		start, end := fset.Position(n.Pos()), fset.Position(n.End())
+		d, ok := inline[start.Line]
+		if !(ok && d.Retry == nil && d.Ensure == "" && len(d.Each) == 0 && len(errVars(d.Expr)) > 0) {
+			return true
+		}
+		line := lines[start.Line-1]
+		if !(start.Line == end.Line && start.Column-1 == len(extractIndent(line))) {
+			return true
+		}
+		if !strings.HasPrefix(strings.TrimSpace(line[end.Column-1:]), "//") {
+			return true
+		}
+		from, to := fset.Position(call.Pos()).Column-1, fset.Position(call.End()).Column-1
+		found = append(found, discard{start.Line, call, line[from:to], errVars(d.Expr)})
+		return true
+	})
+	if len(found) == 0 {
+		return nil, nil // not typed: the shadow follows from the source alone
+	}
+	calls := make([]*ast.CallExpr, len(found))
+	for i, c := range found {
+		calls[i] = c.call
+	}
+	results := e.callResults(path, f, fset, calls)
+	out := make(map[int]boundCall)
+	var warnings []Diagnostic
+	for _, c := range found {
+		names := strings.Join(c.ev, ", ")
+		t, ok := results[c.call]
+		if !ok {
+			warnings = append(warnings, Diagnostic{path, c.line, fmt.Sprintf("result of %s unknown: the directive checks %s, not the errors it discards", c.text, names)})
+			continue
+		}
+		if len(c.ev) == 1 {
+			if !types.Identical(t, errorType) {
+				warnings = append(warnings, Diagnostic{path, c.line, fmt.Sprintf("%s does not return a single error: the directive checks %s, not its result", c.text, names)})
+				continue
+			}
+			out[c.line] = boundCall{call: c.text, lhs: []string{discardedErr}, names: map[string]string{c.ev[0]: discardedErr}}
+			continue
+		}
+		if bc, ok := bindErrResults(c.text, t, c.ev); ok {
+			out[c.line] = bc
+			continue
+		}
+		warnings = append(warnings, Diagnostic{path, c.line, fmt.Sprintf("%s does not return errors named %s: the directive checks them, not its results", c.text, names)})
+	}
+	return out, warnings
+}
+
+// bindErrResults binds the results of type t of call to the error
+// variables ev by name: each must be an error result the callee names, so
+// that the order the condition lists them in does not matter. Other
+// results are discarded.
+func bindErrResults(call string, t types.Type, ev []string) (boundCall, bool) {
+	tuple, ok := t.(*types.Tuple)
+	if !ok {
+		return boundCall{}, false
+	}
+	bc := boundCall{call: call, lhs: make([]string, tuple.Len()), names: make(map[string]string)}
+	for i := range tuple.Len() {
+		v := tuple.At(i)
+		bc.lhs[i] = "_"
+		if !types.Identical(v.Type(), errorType) {
+			continue
+		}
+		if !isErrVar(ev, v.Name()) {
+			return boundCall{}, false
+		}
+		bc.lhs[i] = fmt.Sprintf("%s%d", discardedErr, len(bc.names)+1)
+		bc.names[v.Name()] = bc.lhs[i]
+	}
+	return bc, len(bc.names) == len(ev)
+}
+
+// discardedErr is the name a guard binds a discarded error to.
+const discardedErr = "_incoErr"
+
+// boundCall is a call whose discarded results the guard replacing its
+// statement binds, in its init (see collectDiscarded).
+type boundCall struct {
+	call  string            // the call
+	lhs   []string          // the names its results are bound to
+	names map[string]string // the condition's error variables → the names they are bound as
+}
+
+// bind returns d checking the results of b: its error variables renamed
+// in the condition and the action, its messages still quoting the
+// condition as written.
+func (b boundCall) bind(d *Directive) *Directive {
+	if len(b.names) == 0 {
+		return d
+	}
+	bound := *d
+	if bound.Desc == "" {
+		bound.Desc = d.Expr
+	}
+	bound.Expr = renameIdents(d.Expr, b.names)
+	bound.ActionArgs = make([]string, len(d.ActionArgs))
+	for i, a := range d.ActionArgs {
+		bound.ActionArgs[i] = renameIdents(a, b.names)
+	}
+	if d.Msgf != nil {
+		bound.Msgf = make([]string, len(d.Msgf))
+		for i, a := range d.Msgf {
+			bound.Msgf[i] = renameIdents(a, b.names)
+		}
+	}
+	return &bound
+}
+
+// renameIdents returns the Go source src with the identifiers in names
+// renamed; selectors, such as the Err of v.Err, are not identifiers.
+func renameIdents(src string, names map[string]string) string {
+	fset := token.NewFileSet()
+	file := fset.AddFile("", -1, len(src))
+	var s scanner.Scanner
+	s.Init(file, []byte(src), nil, 0)
+	var b strings.Builder
+	last, prev := 0, token.ILLEGAL
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if to, ok := names[lit]; ok && tok == token.IDENT && prev != token.PERIOD {
+			off := file.Offset(pos)
+			b.WriteString(src[last:off])
+			b.WriteString(to)
+			last = off + len(lit)
+		}
+		prev = tok
+	}
+	b.WriteString(src[last:])
+	return b.String()
+}
+
+// collectLoopBodies maps the first line of every for and range statement
+// to the line of its body's opening brace, where a guard attached to the
+// loop header is emitted.
+func collectLoopBodies(f *ast.File, fset *token.FileSet) map[int]int {
+	out := make(map[int]int)
+	ast.Inspect(f, func(n ast.Node) bool {
+		var body *ast.BlockStmt
+		switch s := n.(type) {
+		case *ast.ForStmt:
+			body = s.Body
+		case *ast.RangeStmt:
+			body = s.Body
+		default:
+			return true
+		}
+		out[fset.Position(n.Pos()).Line] = fset.Position(body.Lbrace).Line
+		return true
+	})
+	return out
+}
+
+// initSplit describes an if or switch header whose init statement carries
+// an inline directive, split so the init can run ahead of the statement.
+type initSplit struct {
+	prefix string // text before the keyword: indentation or "} else "
+	init   string // the init statement
+	header string // the header without its init, e.g. "if cond {"
+	end    int    // last line of the statement, after which the block closes
+}
+
+// collectInits finds inline directives attached to the init statement of
+// an if or switch. A guard cannot run between the init and the condition,
+// so the generator rewrites
+//
+//	if res, err := svc.Do(); res.OK { // @inco: err == nil, -return(err)
+//
+// into a block that declares the init's variables first:
+//
+//	{
+//		res, err := svc.Do()
+//		if !(err == nil) {
+//			return err
+//		}
+//		if res.OK {
+//		...
+//	}
+//
+// Labeled statements and headers whose init spans several lines are left
+// unchanged.
+func collectInits(f *ast.File, fset *token.FileSet, lines []string, inline map[int]*Directive) map[int]initSplit {
+	labeled := make(map[ast.Stmt]bool)
+	out := make(map[int]initSplit)
+	ast.Inspect(f, func(n ast.Node) bool {
+		var init ast.Stmt
+		switch s := n.(type) {
+		case *ast.LabeledStmt:
+			labeled[s.Stmt] = true
+		case *ast.IfStmt:
+			init = s.Init
+		case *ast.SwitchStmt:
+			init = s.Init
+		case *ast.TypeSwitchStmt:
+			init = s.Init
+		}
+		if init == nil || labeled[n.(ast.Stmt)] {
+			return true
+		}
+		kw, start, end := fset.Position(n.Pos()), fset.Position(init.Pos()), fset.Position(init.End())
+		if _, ok := inline[start.Line]; !(ok && kw.Line == start.Line && end.Line == start.Line) {
+			return true
+		}
+		if raw := fset.PositionFor(n.Pos(), false); raw != kw || end.Column-1 > len(lines[kw.Line-1]) {
+			// Under a //line directive of the source: its columns do not
+			// index lines.
+			return true
+		}
+		line := lines[kw.Line-1]
+		rest := strings.TrimLeft(line[end.Column-1:], " \t")
+		rest = strings.TrimLeft(strings.TrimPrefix(rest, ";"), " \t")
+		keyword := "if "
+		if _, ok := n.(*ast.IfStmt); !ok {
+			keyword = "switch "
+		}
+		out[kw.Line] = initSplit{
+			prefix: line[:kw.Column-1],
+			init:   line[start.Column-1 : end.Column-1],
+			header: keyword + rest,
+			end:    fset.Position(n.End()).Line,
+		}
+		return true
+	})
+	return out
+}
+
+// tryIfBlock is generateIfBlock for files that may be best-effort: there a
+// directive that cannot be generated is dropped (ok == false) instead of
+// failing the run. Elsewhere errors propagate as panics.
+func (e *Engine) tryIfBlock(g *shadowGen, d *Directive, indent string, line int, bestEffort bool) (block string, ok bool) {
+	if !bestEffort {
+		return e.generateIfBlock(g, d, indent, line), true
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			block, ok = "", false
+		}
+	}()
+	return e.generateIfBlock(g, d, indent, line), true
+}
+
+// errFileTimeout is returned by runWithin when its function outlives the
+// time limit.
+var errFileTimeout = errors.New("file timeout")
+
+// runWithin calls fn and returns its error, or errFileTimeout once d has
+// elapsed without fn returning. fn then runs to completion in the
+// background and its result is discarded. d <= 0 means no limit.
+func runWithin(d time.Duration, fn func() error) error {
+	if d <= 0 {
+		return fn()
+	}
+	done := make(chan error, 1)
+	go func() { done <- fn() }()
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		return errFileTimeout
+	}
+}
+
+// isBestEffort reports whether path falls under a Config.BestEffort
+// pattern, matching the file itself or any directory above it. No file is
+// best-effort in strict mode.
+func (e *Engine) isBestEffort(path string) bool {
+	return !e.Config.Strict && e.matchPatterns(e.Config.BestEffort, path)
+}
+
+// disabledKinds returns the directive kinds that Config.Disable turns off
+// for path, or nil when every kind is enabled.
+func (e *Engine) disabledKinds(path string) map[string]bool {
+	var off map[string]bool
+	for _, rule := range e.Config.Disable {
+		if !e.matchPatterns(rule.Paths, path) {
+			continue
+		}
+		if off == nil {
+			off = make(map[string]bool)
+		}
+		for _, k := range rule.Kinds {
+			off[k] = true
 		}
 	}
+	return off
+}
 
-	// 4. Build output.
-	var output []string
-	prevWasDirective := false
-
-	for idx, line := range lines {
-		lineNum := idx + 1
+// matchPatterns reports whether path, relative to Root, matches one of
+// the .incoignore-style patterns, either itself or through any directory
+// above it.
+func (e *Engine) matchPatterns(patterns []string, path string) bool {
+	list := NewIgnoreList(patterns)
+	if list == nil {
+		return false
+	}
+	rel, err := filepath.Rel(e.Root, path)
+	_ = err // @inco: err == nil, -return(false)
+	if !(err == nil) {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	if list.Match(rel, false) {
+		return true
+	}
+	for dir := filepath.ToSlash(filepath.Dir(rel)); dir != "." && dir != "/"; dir = filepath.ToSlash(filepath.Dir(dir)) {
+		if list.Match(dir, true) {
+			return true
+		}
+	}
+	return false
+}
 
-		if d, ok := standalone[lineNum]; ok {
-			indent := extractIndent(line)
-			output = append(output, fmt.Sprintf("//line %s:%d", path, lineNum))
-			output = append(output, e.generateIfBlock(d, indent, path, lineNum))
-			prevWasDirective = true
-		} else if d, ok := inline[lineNum]; ok {
-			output = append(output, line)
-			indent := extractIndent(line)
-			output = append(output, e.generateIfBlock(d, indent, path, lineNum))
-			prevWasDirective = true
-		} else {
-			if prevWasDirective {
-				output = append(output, fmt.Sprintf("//line %s:%d", path, lineNum))
-				prevWasDirective = false
-			}
-			output = append(output, line)
+// generateIfBlock returns the text of the injected if-statement.
+//
+//	if !(expr) {
+//	    panic(...)
+//	}
+//
+// A -valid directive binds the validation error in the if-statement's
+// init, so actions can refer to it as err:
+//
+//	if err := validate(v); !(err == nil) {
+//	    return err
+//	}
+//
+// A directive on a statement that discards a call's error binds that
+// error the same way (see collectDiscarded). A -sample rate short-circuits
+// the condition, which is then evaluated only for that fraction of runs:
+//
+//	if inco.Sample(0.01) && !(expr) {
+//
+// A postcondition is deferred, so it sees the function's final results;
+// -onsuccess and -onerror test the named error result first:
+//
+//	defer func() {
+//	    if err == nil && !(expr) {
+//	        panic(...)
+//	    }
+//	}()
+func (e *Engine) generateIfBlock(g *shadowGen, d *Directive, indent string, line int) string {
+	if len(d.Each) > 0 {
+		blocks := make([]string, len(d.Each))
+		for i, sub := range d.Each {
+			blocks[i] = e.generateIfBlock(g, sub, indent, line)
+		}
+		return strings.Join(blocks, "\n")
+	}
+	bc, bound := g.results[line]
+	if bound {
+		d = bc.bind(d)
+	}
+	expr := e.guardExpr(g, d, line)
+	if d.Action.structured() {
+		g.addImport("log/slog")
+	}
+	cond := fmt.Sprintf("!(%s)", expr)
+	if d.Sample != "" {
+		g.addImport(RuntimeImport)
+		cond = fmt.Sprintf("inco.Sample(%s) && %s", d.Sample, cond)
+	}
+	switch d.Ensure {
+	case EnsureOnSuccess, EnsureOnError:
+		errName := g.errResultAt(line)
+		_ = errName // @inco: errName != "" && errName != "_", -panic(fmt.Errorf("%s:%d: -%s requires a named error result", g.path, line, d.Ensure))
+		if !(errName != "" && errName != "_") {
+			panic(fmt.Errorf("%s:%d: -%s requires a named error result", g.path, line, d.Ensure))
+		}
+		op := " == nil && "
+		if d.Ensure == EnsureOnError {
+			op = " != nil && "
 		}
+		cond = errName + op + cond
+	}
+	gated := e.Config.GateTag != ""
+	if gated && d.Flag != "valid" {
+		cond = GateConst + " && " + cond
+	}
+	if d.Flag == "valid" {
+		cond = fmt.Sprintf("err := %s; %s", e.validateCall(g, d, line), cond)
+	} else if bound {
+		cond = fmt.Sprintf("%s := %s; %s", strings.Join(bc.lhs, ", "), bc.call, cond)
+	}
+	body := e.buildPanicBody(g, d, line)
+	if ctx := g.tracedAt(line); ctx != "" {
+		body = e.traceViolation(g, d, ctx, line) + "; " + body
+	}
+	block := fmt.Sprintf("%sif %s {\n%s\t%s\n%s}", indent, cond, indent, body, indent)
+	if d.Retry != nil {
+		block = e.generateRetry(g, d, cond, indent, line) + "\n" + block
+	}
+	if gated && d.Flag == "valid" {
+		// The validator runs in the if-statement's init, which a gated
+		// condition would not skip.
+		block = fmt.Sprintf("%sif %s {\n%s\n%s}", indent, GateConst, indentBlock(block), indent)
+	}
+	if d.Ensure != "" {
+		block = fmt.Sprintf("%sdefer func() {\n%s\n%s}()", indent, indentBlock(block), indent)
 	}
+	return block
+}
 
-	// 5. Add missing imports.
-	content := strings.Join(output, "\n")
-	content = e.addMissingImports(content, f, directives)
+// indentBlock indents every line of a generated block by one tab.
+func indentBlock(block string) string {
+	return "\t" + strings.ReplaceAll(block, "\n", "\n\t")
+}
 
-	return []byte(content)
+// generatePackageInit returns an init function holding the guards of
+// package-level directives, in source order:
+//
+//	var cfg = mustParse(raw) // @inco: cfg.Port > 0
+//
+// becomes, at the end of the shadow,
+//
+//	func init() {
+//	    if !(cfg.Port > 0) {
+//	        panic(...)
+//	    }
+//	}
+//
+// It runs after every package-level variable is initialized, and after
+// the init functions declared earlier in the file.
+func (e *Engine) generatePackageInit(g *shadowGen, directives map[int]*Directive, bestEffort bool) string {
+	lines := make([]int, 0, len(directives))
+	for ln := range directives {
+		lines = append(lines, ln)
+	}
+	sort.Ints(lines)
+	var b strings.Builder
+	b.WriteString("func init() {\n")
+	for _, ln := range lines {
+		if block, ok := e.tryIfBlock(g, directives[ln], "\t", ln, bestEffort); ok {
+			fmt.Fprintf(&b, "//line %s:%d\n%s\n", g.file, ln, block)
+		}
+	}
+	b.WriteString("}")
+	return b.String()
 }
 
-// ---------------------------------------------------------------------------
-// Code generation
-// ---------------------------------------------------------------------------
+// generateRetry returns the loop that repeats a -retry assignment while
+// its condition fails, sleeping for the optional backoff between attempts:
+//
+//	for _incoTry := 1; _incoTry < n && !(expr); _incoTry++ {
+//	    time.Sleep(backoff)
+//	    a, err = call()
+//	}
+//
+// The regular guard follows the loop, so the action runs only once all
+// attempts are exhausted.
+func (e *Engine) generateRetry(g *shadowGen, d *Directive, cond, indent string, line int) string {
+	stmt, ok := g.retries[line]
+	_ = ok // @inco: ok, -panic(fmt.Errorf("%s:%d: -retry requires an inline assignment", g.path, line))
+	if !(ok) {
+		panic(fmt.Errorf("%s:%d: -retry requires an inline assignment", g.path, line))
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%sfor _incoTry := 1; _incoTry < %s && %s; _incoTry++ {\n", indent, d.Retry[0], cond)
+	if len(d.Retry) > 1 {
+		g.addImport("time")
+		fmt.Fprintf(&b, "%s\ttime.Sleep(%s)\n", indent, d.Retry[1])
+	}
+	fmt.Fprintf(&b, "%s\t%s\n%s}", indent, stmt, indent)
+	return b.String()
+}
 
-// generateIfBlock returns the text of the injected if-statement.
+// generatePrologue returns a single guard covering a run of entry
+// preconditions. The conditions are evaluated once each, in order, in a
+// function literal the compiler inlines, which yields the index of the
+// first to fail; only then is the runtime helper called, with a
+// descriptor hoisted into a package-level var that keeps each directive's
+// message (see inco.Prologue):
 //
-//	if !(expr) {
-//	    panic(...)
+//	if _incoFail := func() int {
+//	    if !(a) {
+//	        return 0
+//	    }
+//	    if !(b) {
+//	        return 1
+//	    }
+//	    return -1
+//	}(); _incoFail >= 0 {
+//	    _incoPrologue_<id>_N.Fail(_incoFail)
 //	}
-func (e *Engine) generateIfBlock(d *Directive, indent, path string, line int) string {
-	cond := fmt.Sprintf("!(%s)", d.Expr)
-	body := e.buildPanicBody(d, path, line)
-	return fmt.Sprintf("%sif %s {\n%s\t%s\n%s}", indent, cond, indent, body, indent)
+func (e *Engine) generatePrologue(g *shadowGen, directives map[int]*Directive, group []int, indent string) string {
+	g.addImport(RuntimeImport)
+	name := fmt.Sprintf("_incoPrologue_%s_%d", g.id, g.sites)
+	g.sites++
+	violation := e.Config.PanicValue == PanicViolation
+	var file string
+	checks := make([]string, len(group))
+	var b strings.Builder
+	fmt.Fprintf(&b, "%sif _incoFail := func() int {\n", indent)
+	if e.Config.GateTag != "" {
+		fmt.Fprintf(&b, "%s\tif !%s {\n%s\t\treturn -1\n%s\t}\n", indent, GateConst, indent, indent)
+	}
+	for i, ln := range group {
+		d := directives[ln]
+		fmt.Fprintf(&b, "//line %s:%d\n", g.file, ln)
+		fmt.Fprintf(&b, "%s\tif !(%s) {\n%s\t\treturn %d\n%s\t}\n", indent, e.guardExpr(g, d, ln), indent, i, indent)
+		var kind, detail string
+		kind, detail, file = e.describe(g, d, ln)
+		if violation {
+			checks[i] = fmt.Sprintf("\t{Kind: %q, Line: %d, Expr: %q},", kind, ln, detail)
+		} else {
+			checks[i] = fmt.Sprintf("\t{Line: %d, Msg: %s},", ln, e.violationMsg(g, d, ln))
+		}
+	}
+	fmt.Fprintf(&b, "%s\treturn -1\n%s}(); _incoFail >= 0 {\n", indent, indent)
+	fmt.Fprintf(&b, "//line %s:%d\n", g.file, group[0])
+	fmt.Fprintf(&b, "%s\t%s.Fail(_incoFail)\n%s}", indent, name, indent)
+
+	fn := g.funcAt(group[0])
+	if fn != "" {
+		fn = g.pkg + "." + fn
+	}
+	fields := fmt.Sprintf("Func: %q, File: %q", fn, file)
+	if violation {
+		fields += ", Violation: true"
+		if e.Config.StackTrace {
+			fields += ", Stack: true"
+		}
+	}
+	g.decls = append(g.decls, fmt.Sprintf("var %s = &inco.Prologue{%s, Checks: []inco.Check{\n%s\n}}", name, fields, strings.Join(checks, "\n")))
+	return b.String()
 }
 
 // buildPanicBody generates the action statement for @inco:.
 //
 //   - ActionReturn + args → return arg0, arg1, ...
 //   - ActionReturn bare   → return
-//   - ActionContinue      → continue
+//   - ActionContinue      → continue [label]
 //   - ActionDo + args     → args[0]; args[1]; ...
-//   - ActionBreak         → break
+//   - ActionBreak         → break [label]
+//   - ActionLog + args    → log.Println(args...) (or Config.Logger)
+//   - ActionLog bare      → log.Println("inco violation: ...")
+//   - ActionSlog          → slog.Error("inco violation", "kind", ..., args...)
+//   - ActionWarn          → slog.Warn(...), same arguments
 //   - ActionPanic + args  → panic(arg)
 //   - ActionPanic default → panic("inco violation: <expr> (at file:line)")
-func (e *Engine) buildPanicBody(d *Directive, path string, line int) string {
+//   - -wrap("ctx")        → the error replaced by fmt.Errorf("ctx: %w", err)
+//     (errors.Join of every checked error when there are several)
+//
+// With Config.PanicValue set to PanicViolation, default panics carry an
+// *inco.Violation instead of the message string (see violationValue).
+// A -metric counter and a -call handler run first:
+//
+//	inco.Count("name"); report(inco.NewViolation(...)); return err
+//
+// A -metric without an action only counts (ActionMetric).
+func (e *Engine) buildPanicBody(g *shadowGen, d *Directive, line int) string {
+	if d.Metric != "" {
+		action := *d
+		action.Metric = ""
+		g.addImport(RuntimeImport)
+		count := "inco.Count(" + d.Metric + ")"
+		if d.Action == ActionMetric && d.Call == "" {
+			return count
+		}
+		return count + "; " + e.buildPanicBody(g, &action, line)
+	}
+	if d.Call != "" {
+		action := *d
+		action.Call = ""
+		handler := d.Call + "(" + e.violationValue(g, d, line, checkedErr(g, d)) + ")"
+		if d.Action == ActionMetric {
+			return handler
+		}
+		return handler + "; " + e.buildPanicBody(g, &action, line)
+	}
+	if d.LogOnce || d.LogEvery != "" {
+		action := *d
+		action.LogOnce, action.LogEvery = false, ""
+		return g.throttle(d, e.buildPanicBody(g, &action, line))
+	}
+	if d.Wrap != "" {
+		return e.buildWrapBody(g, d, line)
+	}
 	switch d.Action {
 	case ActionReturn:
-		if len(d.ActionArgs) > 0 {
-			return "return " + strings.Join(d.ActionArgs, ", ")
+		if len(d.ActionArgs) == 0 {
+			return "return"
 		}
-		return "return"
-	case ActionContinue:
-		return "continue"
-	case ActionBreak:
-		return "break"
+		// A condition checking several errors returns all of them, joined,
+		// in place of each one the return names.
+		args := slices.Clone(d.ActionArgs)
+		if ev := errVars(d.Expr); len(ev) > 1 {
+			for i, a := range args {
+				if isErrVar(ev, a) {
+					args[i] = checkedErr(g, d)
+				}
+			}
+		}
+		return "return " + strings.Join(args, ", ")
+	case ActionContinue, ActionBreak:
+		stmt := d.Action.String()
+		if len(d.ActionArgs) == 0 {
+			return stmt
+		}
+		label := d.ActionArgs[0]
+		target := "statement"
+		if d.Action == ActionContinue {
+			target = "loop"
+		}
+		_ = label // @inco: g.hasLabel(line, label, d.Action == ActionContinue), -panic(fmt.Errorf("%s:%d: -%s(%s): no enclosing %s labeled %s", g.path, line, stmt, label, target, label))
+		if !(g.hasLabel(line, label, d.Action == ActionContinue)) {
+			panic(fmt.Errorf("%s:%d: -%s(%s): no enclosing %s labeled %s", g.path, line, stmt, label, target, label))
+		}
+		return stmt + " " + label
 	case ActionDo:
 		return strings.Join(d.ActionArgs, "; ")
 	case ActionLog:
-		return "log.Println(" + strings.Join(d.ActionArgs, ", ") + ")"
+		if len(d.ActionArgs) > 0 {
+			return e.logCall(g, line, strings.Join(d.ActionArgs, ", "))
+		}
+		return e.logCall(g, line, e.violationMsg(g, d, line))
+	case ActionSlog, ActionWarn:
+		return e.slogCall(g, d, line, checkedErr(g, d))
 	default: // ActionPanic
 		if len(d.ActionArgs) > 0 {
 			return "panic(" + d.ActionArgs[0] + ")"
 		}
-		relPath := path
-		if rel, err := filepath.Rel(e.Root, path); err == nil {
-			relPath = rel
+		if e.Config.PanicValue == PanicViolation && d.Msgf == nil {
+			return "panic(" + e.violationValue(g, d, line, checkedErr(g, d)) + ")"
+		}
+		return "panic(" + e.violationMsg(g, d, line) + ")"
+	}
+}
+
+// throttle rate-limits a logging statement with per-site state hoisted
+// into a package-level var:
+//
+//	-logonce     → _incoSite_<id>_N.Do(func() { log... })            (sync.Once)
+//	-logevery(n) → if (_incoSite_<id>_N.Add(1)-1)%n == 0 { log... }  (atomic.Uint64)
+func (g *shadowGen) throttle(d *Directive, stmt string) string {
+	name := fmt.Sprintf("_incoSite_%s_%d", g.id, g.sites)
+	g.sites++
+	if d.LogOnce {
+		g.addImport("sync")
+		g.decls = append(g.decls, fmt.Sprintf("var %s sync.Once", name))
+		return fmt.Sprintf("%s.Do(func() { %s })", name, stmt)
+	}
+	g.addImport("sync/atomic")
+	g.decls = append(g.decls, fmt.Sprintf("var %s atomic.Uint64", name))
+	return fmt.Sprintf("if (%s.Add(1)-1)%%uint64(%s) == 0 { %s }", name, d.LogEvery, stmt)
+}
+
+// checkedErr returns the expression for the error a directive tests:
+// the validation error of -valid, the single error of an "err == nil"
+// condition, errors.Join of several, or "nil".
+func checkedErr(g *shadowGen, d *Directive) string {
+	if d.Flag == "valid" {
+		return "err"
+	}
+	ev := errVars(d.Expr)
+	switch len(ev) {
+	case 0:
+		return "nil"
+	case 1:
+		return ev[0]
+	}
+	g.addImport("errors")
+	return "errors.Join(" + strings.Join(ev, ", ") + ")"
+}
+
+// violationValue returns the structured panic value of a failed check:
+//
+//	inco.NewViolation("require", "main.F", "x > 0", "main.go", 12, nil)
+//
+// err is the checked error expression.
+func (e *Engine) violationValue(g *shadowGen, d *Directive, line int, err string) string {
+	g.addImport(RuntimeImport)
+	kind, detail, file := e.describe(g, d, line)
+	fn := g.funcAt(line)
+	if fn != "" {
+		fn = g.pkg + "." + fn
+	}
+	v := fmt.Sprintf("inco.NewViolation(%q, %q, %q, %q, %d, %s)", kind, fn, detail, file, line, err)
+	if e.Config.StackTrace {
+		v += ".WithStack()"
+	}
+	return v
+}
+
+// logCall returns the configured logger call (log.Println by default)
+// with args, and records the logger's import.
+func (e *Engine) logCall(g *shadowGen, line int, args string) string {
+	l := e.Config.logger()
+	if e.Config.StackTrace {
+		g.addImport("runtime/debug")
+		args += `, "\n" + string(debug.Stack())`
+	}
+	call := strings.ReplaceAll(l.Expr, "%s", args)
+	_, err := parser.ParseExpr(call)
+	_ = err // @inco: err == nil, -panic(fmt.Errorf("%s:%d: logger: %w", g.path, line, err))
+	if !(err == nil) {
+		panic(fmt.Errorf("%s:%d: logger: %w", g.path, line, err))
+	}
+	if l.Import != "" {
+		g.addImport(l.Import)
+	}
+	return call
+}
+
+// slogCall returns the structured log record of a -slog directive:
+//
+//	slog.Error("inco violation", "kind", "require", "file", "main.go", "line", 12, "expr", "x > 0")
+//
+// followed by "err" when the condition tests an error and by the
+// directive's own arguments. -msgf replaces the message. Inside a function
+// whose first parameter is a context.Context, the record is logged with
+// slog.ErrorContext so handlers see request-scoped values. -warn logs at
+// warning level (slog.Warn, slog.WarnContext).
+func (e *Engine) slogCall(g *shadowGen, d *Directive, line int, err string) string {
+	msg := `"inco violation"`
+	if d.Msgf != nil {
+		g.addImport("fmt")
+		msg = "fmt.Sprintf(" + strings.Join(d.Msgf, ", ") + ")"
+	}
+	kind, detail, file := e.describe(g, d, line)
+	args := []string{msg,
+		`"kind"`, strconv.Quote(kind),
+		`"file"`, strconv.Quote(file),
+		`"line"`, strconv.Itoa(line),
+		`"expr"`, strconv.Quote(detail),
+	}
+	if err != "nil" {
+		args = append(args, `"err"`, err)
+	}
+	if e.Config.StackTrace {
+		g.addImport("runtime/debug")
+		args = append(args, `"stack"`, "string(debug.Stack())")
+	}
+	args = append(args, d.ActionArgs...)
+	level := "Error"
+	if d.Action == ActionWarn {
+		level = "Warn"
+	}
+	if ctx := g.ctxAt(line); ctx != "" {
+		return "slog." + level + "Context(" + ctx + ", " + strings.Join(args, ", ") + ")"
+	}
+	return "slog." + level + "(" + strings.Join(args, ", ") + ")"
+}
+
+// describe returns the machine-readable facts of a directive: its kind
+// ("require" for standalone directives, "must" for those attached to a
+// statement, "ensure" for postconditions), the condition or flag description, and the file relative
+// to the root.
+func (e *Engine) describe(g *shadowGen, d *Directive, line int) (kind, detail, file string) {
+	file = g.path
+	if rel, err := filepath.Rel(e.Root, g.path); err == nil {
+		file = filepath.ToSlash(rel)
+	}
+	detail = d.Expr
+	if d.Desc != "" {
+		detail = d.Desc
+	}
+	kind = KindRequire
+	if d.Ensure != "" {
+		kind = KindEnsure
+	} else if _, ok := g.inline[line]; ok {
+		kind = KindMust
+	}
+	return kind, detail, file
+}
+
+// buildWrapBody generates the action for a -wrap directive, replacing
+// the error with fmt.Errorf("<context>: %w", err). A condition that
+// checks several errors ("err1 == nil && err2 == nil") wraps all of them,
+// joined with errors.Join, in place of each one the return names.
+func (e *Engine) buildWrapBody(g *shadowGen, d *Directive, line int) string {
+	g.addImport("fmt")
+	ev := errVars(d.Expr)
+	joined := ev[0]
+	if len(ev) > 1 {
+		g.addImport("errors")
+		joined = "errors.Join(" + strings.Join(ev, ", ") + ")"
+	}
+	// The context is part of the format: its own verbs must not be.
+	ctx, _ := strconv.Unquote(d.Wrap)
+	wrapped := fmt.Sprintf("fmt.Errorf(%s, %s)", strconv.Quote(strings.ReplaceAll(ctx, "%", "%%")+": %w"), joined)
+	switch d.Action {
+	case ActionReturn:
+		args := make([]string, len(d.ActionArgs))
+		for i, a := range d.ActionArgs {
+			args[i] = a
+			if isErrVar(ev, a) {
+				args[i] = wrapped
+			}
+		}
+		return "return " + strings.Join(args, ", ")
+	case ActionLog:
+		return e.logCall(g, line, wrapped)
+	case ActionSlog, ActionWarn:
+		return e.slogCall(g, d, line, wrapped)
+	default: // ActionPanic
+		if e.Config.PanicValue == PanicViolation {
+			return "panic(" + e.violationValue(g, d, line, wrapped) + ")"
+		}
+		return "panic(" + wrapped + ")"
+	}
+}
+
+// violationMsg returns a Go expression for the default message of a
+// directive, rendered from Config.MessageTemplate (DefaultMessageTemplate
+// when unset):
+//
+//	"inco violation: <desc or expr> (at file:line)"
+//
+// With Config.LocationTable the location is referenced from the per-file
+// table instead of being embedded in the literal. A -msgf option replaces
+// the message with fmt.Sprintf of its arguments.
+func (e *Engine) violationMsg(g *shadowGen, d *Directive, line int) string {
+	if d.Msgf != nil {
+		g.addImport("fmt")
+		return "fmt.Sprintf(" + strings.Join(d.Msgf, ", ") + ")"
+	}
+	relPath := g.path
+	if rel, err := filepath.Rel(e.Root, g.path); err == nil {
+		relPath = rel
+	}
+	if e.Config.TrimPath {
+		// The same message on every platform.
+		relPath = filepath.ToSlash(relPath)
+	}
+	kind, detail, _ := e.describe(g, d, line)
+	loc := fmt.Sprintf("%s:%d", relPath, line)
+	tmpl := e.Config.MessageTemplate
+	if tmpl == "" {
+		tmpl = DefaultMessageTemplate
+	}
+	text := strings.NewReplacer(
+		"{pkg}", g.pkg,
+		"{func}", g.funcAt(line),
+		"{kind}", kind,
+		"{detail}", detail,
+		"{file}", relPath,
+		"{line}", strconv.Itoa(line),
+	).Replace(tmpl)
+
+	var msg string
+	if e.Config.LocationTable {
+		parts := strings.Split(text, "{loc}")
+		quoted := make([]string, len(parts))
+		for i, p := range parts {
+			quoted[i] = fmt.Sprintf("%q", p)
 		}
-		msg := fmt.Sprintf("inco violation: %s (at %s:%d)", d.Expr, relPath, line)
-		return fmt.Sprintf("panic(%q)", msg)
+		msg = strings.Join(quoted, " + "+g.locRef(line, loc)+" + ")
+	} else {
+		msg = fmt.Sprintf("%q", strings.ReplaceAll(text, "{loc}", loc))
+	}
+	switch d.Flag {
+	case "valid":
+		msg += ` + ": " + err.Error()`
+	case "idx":
+		g.addImport("fmt")
+		msg += fmt.Sprintf(` + fmt.Sprintf(": index %%d, len %%d", %s, len(%s))`, d.FlagArgs[0], d.FlagArgs[1])
 	}
+	return msg
 }
 
 // ---------------------------------------------------------------------------
@@ -368,10 +2426,13 @@ func (e *Engine) buildImportMap() map[string]string {
 		ambiguous := make(map[string]bool)
 
 		// 1. All standard library packages.
-		e.collectPackages(ambiguous, "-e", "std")
+		e.collectPackages(ambiguous, nil, "-e", "std")
 
-		// 2. Packages already used in the module (covers third-party deps).
-		e.collectPackages(ambiguous, "-e", "-deps", "./...")
+		// 2. Packages already used in the module (covers third-party deps),
+		// on every platform it is built for.
+		for _, ctxt := range e.Config.buildContexts(e.Root) {
+			e.collectPackages(ambiguous, []string{"GOOS=" + ctxt.GOOS, "GOARCH=" + ctxt.GOARCH}, "-e", "-deps", "./...")
+		}
 
 		// Remove ambiguous names (multiple import paths share a short name,
 		// e.g. "template" → text/template vs html/template).
@@ -382,12 +2443,15 @@ func (e *Engine) buildImportMap() map[string]string {
 	return e.importMap
 }
 
-// collectPackages runs "go list" with the given patterns and records
-// each name → importPath pair in e.importMap.
-func (e *Engine) collectPackages(ambiguous map[string]bool, patterns ...string) {
+// collectPackages runs "go list" with the given patterns, and env added to
+// its environment, and records each name → importPath pair in e.importMap.
+func (e *Engine) collectPackages(ambiguous map[string]bool, env []string, patterns ...string) {
 	args := append([]string{"list", "-f", "{{.Name}} {{.ImportPath}}"}, patterns...)
 	cmd := exec.Command("go", args...)
 	cmd.Dir = e.Root
+	if env != nil {
+		cmd.Env = append(os.Environ(), env...)
+	}
 	out, err := cmd.Output()
 	_ = err // @inco: err == nil, -return
 	if !(err == nil) {
@@ -429,32 +2493,56 @@ var pkgRefRe = regexp.MustCompile(`\b([a-zA-Z_]\w*)\.\w+`)
 // internalPkgRe matches import paths that are internal or vendored.
 var internalPkgRe = regexp.MustCompile(`(^|/)internal/|(^|/)vendor/`)
 
-// addMissingImports re-parses the shadow content, detects package references
-// in directive action args, and adds missing imports via astutil.AddImport.
-func (e *Engine) addMissingImports(content string, origFile *ast.File, directives map[int]*Directive) string {
+// importsEnd returns the line that added imports follow: the end of the
+// last import declaration, or the package clause. The //line directive
+// after them must not end up in the comment above a later import "C",
+// which cgo would compile as its C preamble.
+func importsEnd(f *ast.File, fset *token.FileSet) int {
+	line := fset.PositionFor(f.Name.Pos(), false).Line
+	for _, decl := range f.Decls {
+		if gd, ok := decl.(*ast.GenDecl); ok && gd.Tok == token.IMPORT {
+			line = fset.PositionFor(gd.End(), false).Line
+		}
+	}
+	return line
+}
+
+// missingImports detects package references in directive action args and
+// returns, sorted, the import paths the shadow must add to origFile's.
+// Paths in extra are required by generated code and are always added.
+// With used non-nil, a reference is only imported when the shadow uses
+// its name as a package, not, say, as a local variable that happens to
+// share the name of one.
+func (e *Engine) missingImports(origFile *ast.File, directives map[int]*Directive, extra []string, used map[string]bool) []string {
 	// 1. Collect all package-qualified identifiers from directives.
 	needed := make(map[string]bool)
 	for _, d := range directives {
-		sources := d.ActionArgs
-		if d.Expr != "" {
-			sources = append(sources, d.Expr)
+		sources := append(append(append([]string(nil), d.ActionArgs...), d.Msgf...), d.Except...)
+		for _, s := range []string{d.Expr, d.Call} {
+			if s != "" {
+				sources = append(sources, s)
+			}
 		}
 		for _, s := range sources {
 			for _, match := range pkgRefRe.FindAllStringSubmatch(s, -1) {
-				needed[match[1]] = true
+				if used == nil || used[match[1]] {
+					needed[match[1]] = true
+				}
 			}
 		}
 	}
 //line /Users/hitomikirigiri/Desktop/imnive/inco/internal/inco/engine.inco.go:388
-	if !(len(needed) > 0) {
-		return content
+	if !(len(needed) > 0 || len(extra) > 0) {
+		return nil
 	}
 //line /Users/hitomikirigiri/Desktop/imnive/inco/internal/inco/engine.inco.go:389
 
 	// 2. Determine which packages are already imported.
 	imported := make(map[string]bool)
+	importedPaths := make(map[string]bool)
 	for _, imp := range origFile.Imports {
 		path := strings.Trim(imp.Path.Value, `"`)
+		importedPaths[path] = true
 		// Use local name if aliased, otherwise last segment.
 		var name string
 		if imp.Name != nil {
@@ -467,85 +2555,128 @@ func (e *Engine) addMissingImports(content string, origFile *ast.File, directive
 	}
 
 	// 3. Find which needed packages are missing.
-	importMap := e.buildImportMap()
 	var toAdd []string
+	for _, path := range extra {
+		if !importedPaths[path] {
+			toAdd = append(toAdd, path)
+			importedPaths[path] = true
+		}
+	}
+	var importMap map[string]string
+	if len(needed) > 0 {
+		importMap = e.buildImportMap()
+	}
 	for pkg := range needed {
 //line /Users/hitomikirigiri/Desktop/imnive/inco/internal/inco/engine.inco.go:409
 		if !(!imported[pkg]) {
 			continue
 		}
 //line /Users/hitomikirigiri/Desktop/imnive/inco/internal/inco/engine.inco.go:410
-		if _, ok := importMap[pkg]; ok {
-			toAdd = append(toAdd, pkg)
+		if path, ok := importMap[pkg]; ok && !importedPaths[path] {
+			toAdd = append(toAdd, path)
+			importedPaths[path] = true
 		}
 	}
-//line /Users/hitomikirigiri/Desktop/imnive/inco/internal/inco/engine.inco.go:414
-	if !(len(toAdd) > 0) {
-		return content
-	}
-//line /Users/hitomikirigiri/Desktop/imnive/inco/internal/inco/engine.inco.go:415
-
-	// 4. Re-parse the shadow content and add imports via astutil.
-	fset := token.NewFileSet()
-	shadowAST, err := parser.ParseFile(fset, "", content, parser.ParseComments)
-	_ = err // @inco: err == nil, -return(content)
-	if !(err == nil) {
-		return content
-	}
-//line /Users/hitomikirigiri/Desktop/imnive/inco/internal/inco/engine.inco.go:420
-	for _, pkg := range toAdd {
-		astutil.AddImport(fset, shadowAST, importMap[pkg])
-	}
-
-	// 5. Re-render.
-	var buf strings.Builder
-	err = format.Node(&buf, fset, shadowAST)
-	_ = err // @inco: err == nil, -return(content)
-	if !(err == nil) {
-		return content
-	}
-//line /Users/hitomikirigiri/Desktop/imnive/inco/internal/inco/engine.inco.go:428
-	return buf.String()
+	sort.Strings(toAdd)
+	return toAdd
 }
 
 // ---------------------------------------------------------------------------
 // Shadow & overlay I/O
 // ---------------------------------------------------------------------------
 
-func (e *Engine) writeShadow(origPath string, content []byte) error {
+// writeShadow stores content as the shadow of origPath and returns the
+// shadow path and content hash. If shared already holds a shadow with
+// identical content, that file is reused instead of writing a new one.
+// pos, when not nil, are the line positions of content: its source map
+// is written with it.
+func (e *Engine) writeShadow(origPath string, content []byte, pos []linePos, shared map[string]string) (string, string, error) {
+	hash := sha256.Sum256(content)
+	hexHash := fmt.Sprintf("%x", hash)
+	if sp, ok := shared[hexHash]; ok {
+		if _, err := os.Stat(sp); err == nil {
+			return sp, hexHash, nil
+		}
+	}
+
 	cacheDir := filepath.Join(e.Root, ".inco_cache")
 	err := os.MkdirAll(cacheDir, 0o755)
-	_ = err // @inco: err == nil, -return(fmt.Errorf("writeShadow: mkdir: %w", err))
+	_ = err // @inco: err == nil, -return("", "", fmt.Errorf("writeShadow: mkdir: %w", err))
 	if !(err == nil) {
-		return fmt.Errorf("writeShadow: mkdir: %w", err)
+		return "", "", fmt.Errorf("writeShadow: mkdir: %w", err)
 	}
 //line /Users/hitomikirigiri/Desktop/imnive/inco/internal/inco/engine.inco.go:439
 
-	hash := sha256.Sum256(content)
-	shadowName := fmt.Sprintf("%s_%x.go",
-		strings.TrimSuffix(filepath.Base(origPath), ".go"),
-		hash[:8])
-	shadowPath := filepath.Join(cacheDir, shadowName)
+	shadowPath := filepath.Join(cacheDir, e.shadowName(origPath, hash[:8]))
 
 	err = os.WriteFile(shadowPath, content, 0o644)
-	_ = err // @inco: err == nil, -return(fmt.Errorf("writeShadow: write: %w", err))
+	_ = err // @inco: err == nil, -return("", "", fmt.Errorf("writeShadow: write: %w", err))
 	if !(err == nil) {
-		return fmt.Errorf("writeShadow: write: %w", err)
+		return "", "", fmt.Errorf("writeShadow: write: %w", err)
+	}
+	if pos != nil {
+		err = writeSourceMap(shadowPath, hexHash, origPath, pos)
+		_ = err // @inco: err == nil, -return("", "", err)
+		if !(err == nil) {
+			return "", "", err
+		}
 	}
 //line /Users/hitomikirigiri/Desktop/imnive/inco/internal/inco/engine.inco.go:448
-	e.Overlay.Replace[origPath] = shadowPath
-	return nil
+	shared[hexHash] = shadowPath
+	return shadowPath, hexHash, nil
+}
+
+// shadowName returns the cache file name of a shadow of origPath: the
+// package directory relative to the root with "/" replaced by ".", the
+// source's base name and a hash prefix, e.g. api.v1.handler_3f2a9c0d1e4b5a6f.go
+// for api/v1/handler.go. Shadows of files at the root have no package part.
+func (e *Engine) shadowName(origPath string, hash []byte) string {
+	name := fmt.Sprintf("%s_%x.go", strings.TrimSuffix(filepath.Base(origPath), ".go"), hash)
+	if pkg := relDir(e.Root, filepath.Dir(origPath)); pkg != "." && filepath.IsLocal(pkg) {
+		name = strings.ReplaceAll(pkg, "/", ".") + "." + name
+	}
+	return name
+}
+
+// SourcesFor returns the source files whose overlay entries in the last
+// completed Run point at shadowPath, absolute or relative to Root, in
+// sorted order. Files with identical shadows share one, so there may be
+// several; nil means the path is not a shadow of the overlay.
+func (e *Engine) SourcesFor(shadowPath string) []string {
+	if !filepath.IsAbs(shadowPath) {
+		shadowPath = filepath.Join(e.Root, shadowPath)
+	}
+	shadowPath = filepath.Clean(shadowPath)
+	ov, _ := e.Result()
+	var out []string
+	for src, shadow := range ov.Replace {
+		if shadow == shadowPath {
+			out = append(out, src)
+		}
+	}
+	sort.Strings(out)
+	return out
 }
 
-func (e *Engine) writeOverlay() error {
+// writeOverlay writes ov to overlay.json, with its paths relative to the
+// configured overlay base, if any.
+func (e *Engine) writeOverlay(ov Overlay) error {
 	cacheDir := filepath.Join(e.Root, ".inco_cache")
 	err := os.MkdirAll(cacheDir, 0o755)
 	_ = err // @inco: err == nil, -return(fmt.Errorf("writeOverlay: mkdir: %w", err))
 	if !(err == nil) {
 		return fmt.Errorf("writeOverlay: mkdir: %w", err)
 	}
+	ov = nativeOverlay(ov)
+	if base := e.Config.overlayBase(e.Root); base != "" {
+		ov, err = relOverlay(ov, base)
+		_ = err // @inco: err == nil, -return(fmt.Errorf("writeOverlay: %w", err))
+		if !(err == nil) {
+			return fmt.Errorf("writeOverlay: %w", err)
+		}
+	}
 //line /Users/hitomikirigiri/Desktop/imnive/inco/internal/inco/engine.inco.go:456
-	data, err := json.MarshalIndent(e.Overlay, "", "  ")
+	data, err := json.MarshalIndent(ov, "", "  ")
 	_ = err // @inco: err == nil, -return(fmt.Errorf("writeOverlay: marshal: %w", err))
 	if !(err == nil) {
 		return fmt.Errorf("writeOverlay: marshal: %w", err)
@@ -560,10 +2691,16 @@ func (e *Engine) writeOverlay() error {
 	return nil
 }
 
+// OverlayPath returns the path of the overlay.json written by Run, suitable
+// for "go build -overlay".
+func (e *Engine) OverlayPath() string {
+	return filepath.Join(e.Root, ".inco_cache", "overlay.json")
+}
+
 // loadOverlayIfExists reads the previous overlay.json and returns the
 // shadow path map. Returns nil if the file does not exist.
 func (e *Engine) loadOverlayIfExists() map[string]string {
-	overlayPath := filepath.Join(e.Root, ".inco_cache", "overlay.json")
+	overlayPath := e.OverlayPath()
 	data, err := os.ReadFile(overlayPath)
 	_ = err // @inco: err == nil, -return(nil)
 	if !(err == nil) {
@@ -577,7 +2714,52 @@ func (e *Engine) loadOverlayIfExists() map[string]string {
 		return nil
 	}
 //line /Users/hitomikirigiri/Desktop/imnive/inco/internal/inco/engine.inco.go:472
-	return ov.Replace
+	return absOverlay(ov, e.Config.overlayBase(e.Root)).Replace
+}
+
+// relOverlay returns ov with its paths made relative to base.
+func relOverlay(ov Overlay, base string) (Overlay, error) {
+	out := Overlay{Replace: make(map[string]string, len(ov.Replace))}
+	for src, shadow := range ov.Replace {
+		relSrc, err := filepath.Rel(base, src)
+		_ = err // @inco: err == nil, -return(Overlay{}, err)
+		if !(err == nil) {
+			return Overlay{}, err
+		}
+		relShadow, err := filepath.Rel(base, shadow)
+		_ = err // @inco: err == nil, -return(Overlay{}, err)
+		if !(err == nil) {
+			return Overlay{}, err
+		}
+		out.Replace[relSrc] = relShadow
+	}
+	return out, nil
+}
+
+// nativeOverlay returns ov with its paths spelled as the go command
+// expects them.
+func nativeOverlay(ov Overlay) Overlay {
+	out := Overlay{Replace: make(map[string]string, len(ov.Replace))}
+	for src, shadow := range ov.Replace {
+		out.Replace[nativePath(src)] = nativePath(shadow)
+	}
+	return out
+}
+
+// absOverlay returns ov with its relative paths resolved against base, as
+// written by relOverlay. Absolute paths are kept.
+func absOverlay(ov Overlay, base string) Overlay {
+	out := Overlay{Replace: make(map[string]string, len(ov.Replace))}
+	abs := func(p string) string {
+		if filepath.IsAbs(p) || base == "" {
+			return p
+		}
+		return filepath.Join(base, p)
+	}
+	for src, shadow := range ov.Replace {
+		out.Replace[abs(src)] = abs(shadow)
+	}
+	return out
 }
 
 // ---------------------------------------------------------------------------
@@ -632,16 +2814,34 @@ func (e *Engine) writeManifest(m *Manifest) error {
 	return nil
 }
 
-// hashFile returns the hex-encoded SHA-256 of a file's contents.
-func hashFile(path string) (string, error) {
-	data, err := os.ReadFile(path)
-	_ = err // @inco: err == nil, -return("", fmt.Errorf("hashFile %s: %w", path, err))
+// CompileDBPath returns the path of the compile database written by Run.
+func (e *Engine) CompileDBPath() string {
+	return filepath.Join(e.Root, ".inco_cache", "compile_db.json")
+}
+
+// writeCompileDB writes compile_db.json: one CompileEntry per overlaid
+// file, sorted by source path. It is written after the manifest, whose
+// cache directory it shares.
+func (e *Engine) writeCompileDB(m *Manifest) error {
+	entries := make([]CompileEntry, 0, len(m.Files))
+	for path, me := range m.Files {
+		entries = append(entries, CompileEntry{
+			File: path, Shadow: me.ShadowPath,
+			Directives: me.Directives, Imports: me.Imports,
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].File < entries[j].File })
+	data, err := json.MarshalIndent(entries, "", "  ")
+	_ = err // @inco: err == nil, -return(fmt.Errorf("writeCompileDB: marshal: %w", err))
+	if !(err == nil) {
+		return fmt.Errorf("writeCompileDB: marshal: %w", err)
+	}
+	err = os.WriteFile(e.CompileDBPath(), data, 0o644)
+	_ = err // @inco: err == nil, -return(fmt.Errorf("writeCompileDB: write: %w", err))
 	if !(err == nil) {
-		return "", fmt.Errorf("hashFile %s: %w", path, err)
+		return fmt.Errorf("writeCompileDB: write: %w", err)
 	}
-//line /Users/hitomikirigiri/Desktop/imnive/inco/internal/inco/engine.inco.go:508
-	h := sha256.Sum256(data)
-	return fmt.Sprintf("%x", h), nil
+	return nil
 }
 
 // ---------------------------------------------------------------------------
@@ -653,9 +2853,55 @@ func extractIndent(line string) string {
 	return line[:len(line)-len(strings.TrimLeft(line, " \t"))]
 }
 
+// collectPrologues finds, for every function body, the run of standalone
+// directives on consecutive lines directly after the opening brace. Runs of
+// at least two groupable directives are returned keyed by their first line.
+func collectPrologues(f *ast.File, fset *token.FileSet, standalone map[int]*Directive) map[int][]int {
+	prologues := make(map[int][]int)
+	ast.Inspect(f, func(n ast.Node) bool {
+		var body *ast.BlockStmt
+		switch fn := n.(type) {
+		case *ast.FuncDecl:
+			body = fn.Body
+		case *ast.FuncLit:
+			body = fn.Body
+		}
+		if body == nil {
+			return true
+		}
+		var group []int
+		for ln := fset.Position(body.Lbrace).Line + 1; ; ln++ {
+			d, ok := standalone[ln]
+			if !(ok && groupable(d)) {
+				break
+			}
+			group = append(group, ln)
+		}
+		if len(group) >= 2 {
+			prologues[group[0]] = group
+		}
+		return true
+	})
+	return prologues
+}
+
+// groupable reports whether d may be merged into a prologue: a check
+// whose failure panics with a value the prologue's descriptor can hold,
+// a constant message or a *inco.Violation without an error. Conditions
+// are evaluated as they would be on their own, once each and in order,
+// so they may call anything.
+func groupable(d *Directive) bool {
+	return d.Action == ActionPanic && len(d.ActionArgs) == 0 && d.Msgf == nil &&
+		d.Flag != "valid" && d.Flag != "idx" && len(errVars(d.Expr)) == 0 &&
+		d.Wrap == "" && d.Call == "" && d.Metric == "" && d.Sample == "" &&
+		len(d.Each) == 0 && d.Ensure == ""
+}
+
 // collectStmtLines walks the AST and returns a set of line numbers that
 // contain statements inside function bodies. A directive comment whose
 // line appears in this set is classified as "inline" rather than "standalone".
+// Loop headers count as statements: their guard runs at the top of the
+// body, once per iteration.
 func collectStmtLines(f *ast.File, fset *token.FileSet) map[int]bool {
 	lines := make(map[int]bool)
 	ast.Inspect(f, func(n ast.Node) bool {
@@ -667,10 +2913,98 @@ func collectStmtLines(f *ast.File, fset *token.FileSet) map[int]bool {
 		switch n.(type) {
 		case *ast.AssignStmt, *ast.ExprStmt, *ast.ReturnStmt,
 			*ast.IncDecStmt, *ast.SendStmt, *ast.GoStmt, *ast.DeferStmt,
-			*ast.BranchStmt:
+			*ast.BranchStmt, *ast.ForStmt, *ast.RangeStmt:
 			lines[fset.Position(n.Pos()).Line] = true
 		}
 		return true
 	})
 	return lines
 }
+
+// collectFuncBodies returns the line spans of every function and closure
+// body, braces included.
+func collectFuncBodies(f *ast.File, fset *token.FileSet) []lineRange {
+	var out []lineRange
+	ast.Inspect(f, func(n ast.Node) bool {
+		var body *ast.BlockStmt
+		switch fn := n.(type) {
+		case *ast.FuncDecl:
+			body = fn.Body
+		case *ast.FuncLit:
+			body = fn.Body
+		}
+		if body != nil {
+			out = append(out, lineRange{fset.Position(body.Lbrace).Line, fset.Position(body.Rbrace).Line})
+		}
+		return true
+	})
+	return out
+}
+
+// collectPackageVars returns the lines of single-line package-level var
+// specs, where a trailing directive checks the initialized variable.
+func collectPackageVars(f *ast.File, fset *token.FileSet) map[int]bool {
+	lines := make(map[int]bool)
+	for _, decl := range f.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !(ok && gd.Tok == token.VAR) {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			start, end := fset.Position(spec.Pos()).Line, fset.Position(spec.End()).Line
+			if start == end {
+				lines[start] = true
+			}
+		}
+	}
+	return lines
+}
+
+// funcDecl is the line span, doc comment included, of a function
+// declaration named "F" or "T.M".
+type funcDecl struct {
+	funcRange
+	exported bool // part of the exported API: an exported function, or an exported method of an exported type
+}
+
+// collectFuncDecls returns the function declarations of f.
+func collectFuncDecls(f *ast.File, fset *token.FileSet) []funcDecl {
+	var out []funcDecl
+	for _, decl := range f.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		name := fn.Name.Name
+		exported := fn.Name.IsExported()
+		if fn.Recv != nil && len(fn.Recv.List) > 0 {
+			recv := recvTypeName(fn.Recv.List[0].Type)
+			name = recv + "." + name
+			exported = exported && ast.IsExported(recv)
+		}
+		start := fn.Pos()
+		if fn.Doc != nil {
+			start = fn.Doc.Pos()
+		}
+		out = append(out, funcDecl{funcRange{name, fset.Position(start).Line, fset.Position(fn.End()).Line}, exported})
+	}
+	return out
+}
+
+// compileFuncPatterns compiles Config.Funcs into one regexp matching a
+// whole function name, or returns nil when there are no patterns.
+func compileFuncPatterns(patterns []string) (*regexp.Regexp, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+	alts := make([]string, len(patterns))
+	for i, p := range patterns {
+		_, err := regexp.Compile(p)
+		_ = err // @inco: err == nil, -return(nil, fmt.Errorf("funcs: invalid pattern %q: %w", p, err))
+		if !(err == nil) {
+			return nil, fmt.Errorf("funcs: invalid pattern %q: %w", p, err)
+		}
+		alts[i] = "(?:" + p + ")"
+	}
+	return regexp.Compile("^(?:" + strings.Join(alts, "|") + ")$")
+}
@@ -1,11 +1,30 @@
 package inco
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io"
+	"log/slog"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
+	"time"
 )
 
 // setupDir creates a temp directory with Go source files and returns its path.
@@ -236,6 +255,76 @@ func Do(x int) {
 	}
 }
 
+func TestEngine_OverlayBase(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"cmd/app/main.go": "package main\n\nfunc Do(x int) {\n\t// @inco: x > 0\n}\n",
+	})
+	e := NewEngine(dir)
+	e.Config.OverlayBase = "."
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(e.OverlayPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ov Overlay
+	if err := json.Unmarshal(data, &ov); err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join("cmd", "app", "main.go")
+	shadow, ok := ov.Replace[src]
+	if len(ov.Replace) != 1 || !ok || !strings.HasPrefix(shadow, ".inco_cache"+string(filepath.Separator)) {
+		t.Fatalf("overlay.json = %v, want %s mapped under .inco_cache", ov.Replace, src)
+	}
+	if mem, _ := e.Result(); mem.Replace[filepath.Join(dir, src)] != filepath.Join(dir, shadow) {
+		t.Errorf("in-memory overlay = %v, want absolute paths", mem.Replace)
+	}
+
+	// The next run resolves the relative entries: the shadow is reused,
+	// not deleted as stale.
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if _, stats := e.Result(); stats.Cached != 1 {
+		t.Errorf("cached = %d, want 1", stats.Cached)
+	}
+	if _, err := os.Stat(filepath.Join(dir, shadow)); err != nil {
+		t.Errorf("shadow removed: %v", err)
+	}
+}
+
+func TestEngine_ShadowNames(t *testing.T) {
+	handler := "package %s\n\nfunc Handle(p *int) {\n\t// @inco: p != nil\n}\n"
+	dir := setupDir(t, map[string]string{
+		"main.go":           fmt.Sprintf(handler, "main"),
+		"api/v1/handler.go": fmt.Sprintf(handler, "v1"),
+		"store/handler.go":  fmt.Sprintf(handler, "store"),
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	for src, prefix := range map[string]string{
+		"main.go":           "main_",
+		"api/v1/handler.go": "api.v1.handler_",
+		"store/handler.go":  "store.handler_",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(src))
+		shadow := e.Overlay.Replace[path]
+		if name := filepath.Base(shadow); !strings.HasPrefix(name, prefix) {
+			t.Errorf("shadow of %s = %s, want prefix %s", src, name, prefix)
+		}
+		rel, _ := filepath.Rel(dir, shadow)
+		if got := e.SourcesFor(rel); len(got) != 1 || got[0] != path {
+			t.Errorf("SourcesFor(%s) = %v, want [%s]", rel, got, path)
+		}
+	}
+	if got := e.SourcesFor(filepath.Join(dir, ".inco_cache", "missing.go")); got != nil {
+		t.Errorf("SourcesFor(missing) = %v, want nil", got)
+	}
+}
+
 // ---------------------------------------------------------------------------
 // Skips hidden directories
 // ---------------------------------------------------------------------------
@@ -459,6 +548,67 @@ func FindFirst(nums []int) {
 	}
 }
 
+func TestEngine_BreakLabel(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"main.go": `package main
+
+func Scan(rows [][]int) {
+outer:
+	for _, row := range rows {
+		for _, v := range row {
+			// @inco: v >= 0, -continue(outer)
+			// @inco: v != 42, -break(outer)
+			_ = v
+		}
+	}
+}
+`,
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	shadow := readShadow(t, e)
+	for _, want := range []string{"\t\t\t\tcontinue outer\n", "\t\t\t\tbreak outer\n"} {
+		if !strings.Contains(shadow, want) {
+			t.Errorf("missing %q in:\n%s", want, shadow)
+		}
+	}
+}
+
+func TestEngine_BreakLabelUnknown(t *testing.T) {
+	for name, body := range map[string]string{
+		"missing": `	for _, v := range vs {
+		// @inco: v != 0, -break(outer)
+	}`,
+		// continue cannot target a switch.
+		"switch": `	for _, v := range vs {
+	sw:
+		switch v {
+		case 1:
+			// @inco: v != 0, -continue(sw)
+		}
+	}`,
+		// A closure cannot leave the loop around it.
+		"closure": `outer:
+	for _, v := range vs {
+		func() {
+			// @inco: v != 0, -break(outer)
+		}()
+	}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := setupDir(t, map[string]string{
+				"main.go": "package main\n\nfunc F(vs []int) {\n" + body + "\n}\n",
+			})
+			err := NewEngine(dir).Run()
+			if err == nil || !strings.Contains(err.Error(), "no enclosing") {
+				t.Fatalf("err = %v, want no enclosing label", err)
+			}
+		})
+	}
+}
+
 // ---------------------------------------------------------------------------
 // Log action
 // ---------------------------------------------------------------------------
@@ -589,6 +739,43 @@ func Do(s string) (int, error) {
 	}
 }
 
+func TestEngine_ImportGrooming(t *testing.T) {
+	// user is a parameter, not os/user, and the directive in the ignored
+	// function generates no code that would use fmt.
+	dir := setupDir(t, map[string]string{
+		".inco.json": `{"funcs": ["^Greet$"]}`,
+		"main.go": `package main
+
+type User struct{ Name string }
+
+func Greet(user *User) string {
+	// @inco: user.Name != "", -return(user.Name)
+	return "hi " + user.Name
+}
+
+func other(s string) error {
+	// @inco: s != "", -return(fmt.Errorf("empty"))
+	return nil
+}
+`,
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	shadow := readShadow(t, e)
+	if strings.Contains(shadow, "import") {
+		t.Errorf("unused imports added:\n%s", shadow)
+	}
+	formatted, err := format.Source([]byte(shadow))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(formatted) != shadow {
+		t.Errorf("shadow not gofmt'd:\n%s", shadow)
+	}
+}
+
 // ---------------------------------------------------------------------------
 // Deeply nested closure
 // ---------------------------------------------------------------------------
@@ -917,3 +1104,1905 @@ func Do(x int) {
 		}
 	}
 }
+
+// ---------------------------------------------------------------------------
+// Content-addressed shadows — identical shadows share one file
+// ---------------------------------------------------------------------------
+
+func TestEngine_IdenticalShadowsShared(t *testing.T) {
+	gen := "package gen\n\nfunc Generated() int { return 42 }\n"
+	dir := setupDir(t, map[string]string{
+		"a/gen.go":   gen,
+		"b/other.go": gen,
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	a := e.Overlay.Replace[filepath.Join(dir, "a", "gen.go")]
+	b := e.Overlay.Replace[filepath.Join(dir, "b", "other.go")]
+	if a == "" || a != b {
+		t.Fatalf("identical shadows should share a file: %q vs %q", a, b)
+	}
+	entries, _ := os.ReadDir(filepath.Join(dir, ".inco_cache"))
+	var shadows int
+	for _, ent := range entries {
+		if strings.HasSuffix(ent.Name(), ".go") {
+			shadows++
+		}
+	}
+	if shadows != 1 {
+		t.Errorf("expected 1 shadow file on disk, got %d", shadows)
+	}
+
+	// Deleting one source must not remove the shadow the other still uses.
+	os.Remove(filepath.Join(dir, "a", "gen.go"))
+	e2 := NewEngine(dir)
+	if err := e2.Run(); err != nil {
+		t.Fatal(err)
+	}
+	sp := e2.Overlay.Replace[filepath.Join(dir, "b", "other.go")]
+	if _, err := os.Stat(sp); err != nil {
+		t.Errorf("shared shadow still referenced by b/other.go was removed: %v", err)
+	}
+}
+
+func TestEngine_StatsAndProgress(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"a.go": "package main\n\nfunc A(p *int) {\n\t// @inco: p != nil\n}\n",
+		"b.go": "package main\n\nfunc B(p *int) {\n\t// @inco: p != nil\n}\n",
+	})
+	var calls []int
+	e := NewEngine(dir)
+	e.OnProgress = func(done, total int) {
+		if total != 2 {
+			t.Errorf("total = %d, want 2", total)
+		}
+		calls = append(calls, done)
+	}
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 2 || calls[1] != 2 {
+		t.Errorf("progress calls = %v, want [1 2]", calls)
+	}
+	if want := (RunStats{Mapped: 2, Processed: 2}); e.Stats != want {
+		t.Errorf("Stats = %+v, want %+v", e.Stats, want)
+	}
+
+	e = NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if want := (RunStats{Mapped: 2, Cached: 2}); e.Stats != want {
+		t.Errorf("second run Stats = %+v, want %+v", e.Stats, want)
+	}
+}
+
+func TestEngine_RunReport(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"a.go": `package main
+
+import "time"
+
+// @timing 1s
+func A(p *int) (err error) {
+	// @inco: p != nil
+	// @inco: err == nil, -ensure
+	_ = p // @inco: *p > 0
+	time.Sleep(0)
+	return nil
+}
+`,
+		"b.go":     "package main\n\nfunc B(p *int) {\n\t// @inco: p != nil\n}\n",
+		"plain.go": "package main\n\nfunc main() {}\n",
+		"hidden.go": `package main
+
+func hidden(x int) {
+	// @inco: x > 0
+}
+`,
+	})
+	e := NewEngine(dir)
+	e.Config.ExportedOnly = true
+	r, err := e.RunReport(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.FilesScanned != 4 || r.FilesWithDirectives != 2 || r.Mapped != 4 || r.ShadowsWritten != 4 {
+		t.Errorf("report = %+v", r)
+	}
+	wantKinds := map[string]int{KindRequire: 2, KindMust: 1, KindEnsure: 1, KindAnnotation: 1}
+	if !reflect.DeepEqual(r.DirectivesByKind, wantKinds) {
+		t.Errorf("DirectivesByKind = %v, want %v", r.DirectivesByKind, wantKinds)
+	}
+	wantWarn := []Diagnostic{{filepath.Join(dir, "hidden.go"), 4, "directive in unexported function hidden ignored (exported_only)"}}
+	if !reflect.DeepEqual(r.Warnings, wantWarn) {
+		t.Errorf("Warnings = %+v, want %+v", r.Warnings, wantWarn)
+	}
+	if r.Duration <= 0 {
+		t.Error("Duration not set")
+	}
+
+	// A cached run reports the same directives and warnings, and writes
+	// nothing.
+	e = NewEngine(dir)
+	e.Config.ExportedOnly = true
+	r2, err := e.RunReport(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r2.Cached != 4 || r2.ShadowsWritten != 0 || !reflect.DeepEqual(r2.DirectivesByKind, wantKinds) || !reflect.DeepEqual(r2.Warnings, wantWarn) {
+		t.Errorf("cached report = %+v", r2)
+	}
+}
+
+func TestEngine_FileEvents(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"a.go": "package main\n\nfunc A(p *int) {\n\t// @inco: p != nil\n}\n",
+		"b.go": "package main\n\nfunc b(p *int) {\n\t// @inco: p != nil\n}\n",
+	})
+	var events []string
+	e := NewEngine(dir)
+	e.Config.ExportedOnly = true
+	e.Workers = 1
+	e.OnFileStart = func(path string) { events = append(events, "start "+filepath.Base(path)) }
+	e.OnWarning = func(d Diagnostic) { events = append(events, fmt.Sprintf("warn %s:%d", filepath.Base(d.Path), d.Line)) }
+	e.OnFileDone = func(ev FileEvent) {
+		events = append(events, fmt.Sprintf("done %s %d %v", filepath.Base(ev.Path), ev.Info.Directives, ev.Cached))
+	}
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"start a.go", "done a.go 1 false", "start b.go", "warn b.go:4", "done b.go 0 false"}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %q, want %q", events, want)
+	}
+
+	events = nil
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"start a.go", "done a.go 1 true", "start b.go", "warn b.go:4", "done b.go 0 true"}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("cached events = %q, want %q", events, want)
+	}
+}
+
+func TestEngine_FS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.go":        {Data: []byte("package main\n\nfunc F(p *int) {\n\t// @inco: p != nil\n}\n")},
+		"gen/gen.go":     {Data: []byte("package gen\n\nfunc G(p *int) {\n\t// @inco: p != nil\n}\n")},
+		".incoignore":    {Data: []byte("gen/\n")},
+		".inco.json":     {Data: []byte(`{"exported_only": true}`)},
+		".hidden/x/x.go": {Data: []byte("package x\n\nfunc X(p *int) {\n\t// @inco: p != nil\n}\n")},
+	}
+	root := t.TempDir()
+	e := NewEngineFS(root, fsys)
+	if !e.Config.ExportedOnly {
+		t.Error(".inco.json not read from the FS")
+	}
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	main := filepath.Join(root, "main.go")
+	if len(e.Overlay.Replace) != 1 || e.Overlay.Replace[main] == "" {
+		t.Fatalf("overlay = %v, want only main.go", e.Overlay.Replace)
+	}
+	shadow, err := os.ReadFile(e.Overlay.Replace[main])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(shadow), "p != nil") {
+		t.Errorf("shadow missing check:\n%s", shadow)
+	}
+
+	e.Buffers = map[string][]byte{main: []byte("package main\n\nfunc F(q *int) {\n\t// @inco: q != nil\n}\n")}
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	shadow, err = os.ReadFile(e.Overlay.Replace[main])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(shadow), "q != nil") {
+		t.Errorf("shadow not generated from the buffer:\n%s", shadow)
+	}
+}
+
+func TestEngine_CacheLock(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "plan9" {
+		t.Skip("cache lock is only implemented on unix")
+	}
+	dir := setupDir(t, map[string]string{
+		"main.go": "package main\n\nfunc F(p *int) {\n\t// @inco: p != nil\n}\n",
+	})
+	// Another process holding the lock: flock conflicts between open files
+	// of one process too.
+	unlock, err := lockCache(context.Background(), filepath.Join(dir, ".inco_cache"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewEngine(dir)
+	e.LockTimeout = 100 * time.Millisecond
+	if err := e.Run(); !errors.Is(err, ErrCacheLocked) {
+		t.Fatalf("Run with the cache locked = %v, want ErrCacheLocked", err)
+	}
+
+	e.LockTimeout = 10 * time.Second
+	done := make(chan error)
+	go func() { done <- e.Run() }()
+	time.Sleep(200 * time.Millisecond)
+	unlock()
+	if err := <-done; err != nil {
+		t.Fatalf("Run after the lock is released = %v", err)
+	}
+	if ov, _ := e.Result(); len(ov.Replace) != 1 {
+		t.Errorf("overlay = %v, want main.go", ov.Replace)
+	}
+}
+
+func TestEngine_Workers(t *testing.T) {
+	files := make(map[string]string)
+	for i := 0; i < 16; i++ {
+		files[fmt.Sprintf("p%d/f.go", i)] = fmt.Sprintf("package p%d\n\nfunc F(p *int) {\n\t// @inco: p != nil\n}\n", i)
+	}
+	var overlays []Overlay
+	for _, workers := range []int{1, 4, 0} {
+		dir := setupDir(t, files)
+		e := NewEngine(dir)
+		e.Workers = workers
+		if err := e.Run(); err != nil {
+			t.Fatal(err)
+		}
+		if e.Stats.Processed != 16 {
+			t.Errorf("workers=%d: processed %d files, want 16", workers, e.Stats.Processed)
+		}
+		ov := Overlay{Replace: make(map[string]string)}
+		for src, shadow := range e.Overlay.Replace {
+			rel, _ := filepath.Rel(dir, src)
+			data, err := os.ReadFile(shadow)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ov.Replace[rel] = strings.ReplaceAll(string(data), dir, "")
+		}
+		overlays = append(overlays, ov)
+	}
+	for i := 1; i < len(overlays); i++ {
+		if !reflect.DeepEqual(overlays[i], overlays[0]) {
+			t.Errorf("overlay %d differs from the single-worker run", i)
+		}
+	}
+}
+
+func TestEngine_RunContextCanceled(t *testing.T) {
+	files := make(map[string]string)
+	for i := 0; i < 8; i++ {
+		files[fmt.Sprintf("f%d.go", i)] = fmt.Sprintf("package main\n\nfunc F%d(p *int) {\n\t// @inco: p != nil\n}\n", i)
+	}
+	dir := setupDir(t, files)
+	overlay := filepath.Join(dir, ".inco_cache", "overlay.json")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := NewEngine(dir).RunContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if _, err := os.Stat(overlay); !os.IsNotExist(err) {
+		t.Fatal("a canceled run must not write the overlay")
+	}
+
+	if err := NewEngine(dir).Run(); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.ReadFile(overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(dir, "f0.go"), []byte("package main\n\nfunc F0(p *int) {\n\t// @inco: p == nil\n}\n"), 0o644)
+
+	// Cancel midway: the previous overlay stays in place.
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	e := NewEngine(dir)
+	e.Workers = 1
+	e.OnProgress = func(done, total int) { cancel() }
+	if err := e.RunContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	after, err := os.ReadFile(overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(after) != string(before) {
+		t.Errorf("overlay changed by a canceled run:\n%s\nwant:\n%s", after, before)
+	}
+}
+
+func TestEngine_GenerateFile(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"main.go": "package main\n\nfunc F(p *int) {\n\t// @inco: p != nil\n}\n",
+	})
+	e := NewEngine(dir)
+	shadow, err := e.GenerateFile(filepath.Join(dir, "main.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(shadow), `panic("inco violation: p != nil (at main.go:4)")`) {
+		t.Errorf("unexpected shadow:\n%s", shadow)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".inco_cache")); !os.IsNotExist(err) {
+		t.Error("GenerateFile must not create .inco_cache")
+	}
+	if _, err := e.GenerateFile(filepath.Join(dir, "missing.go")); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
+
+func TestEngine_Msgf(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"main.go": `package main
+
+func Pay(amount int, userID string) {
+	// @inco: amount > 0, -msgf("bad amount %d for user %s", amount, userID)
+	// @inco: userID != "", -log, -msgf("empty user for amount %d", amount)
+}
+`,
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	shadow := readShadow(t, e)
+	for _, want := range []string{
+		`panic(fmt.Sprintf("bad amount %d for user %s", amount, userID))`,
+		`log.Println(fmt.Sprintf("empty user for amount %d", amount))`,
+		`"fmt"`,
+	} {
+		if !strings.Contains(shadow, want) {
+			t.Errorf("missing %q in:\n%s", want, shadow)
+		}
+	}
+}
+
+func TestEngine_CompileDB(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"main.go": `package main
+
+func F(p *int, n int) {
+	// @inco: p != nil, -log
+	// @inco: n > 0
+}
+`,
+	})
+	check := func(e *Engine) {
+		t.Helper()
+		data, err := os.ReadFile(e.CompileDBPath())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var entries []CompileEntry
+		if err := json.Unmarshal(data, &entries); err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 {
+			t.Fatalf("got %d entries, want 1:\n%s", len(entries), data)
+		}
+		got := entries[0]
+		if got.File != filepath.Join(dir, "main.go") || got.Shadow != e.Overlay.Replace[got.File] {
+			t.Errorf("File/Shadow = %q/%q", got.File, got.Shadow)
+		}
+		if got.Directives != 2 {
+			t.Errorf("Directives = %d, want 2", got.Directives)
+		}
+		if len(got.Imports) != 1 || got.Imports[0] != "log" {
+			t.Errorf("Imports = %v, want [log]", got.Imports)
+		}
+	}
+
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	check(e)
+
+	// A cached run must reproduce the same records.
+	e = NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if e.Stats.Cached != 1 {
+		t.Fatalf("expected cached run, got %+v", e.Stats)
+	}
+	check(e)
+}
+
+func TestEngine_Wrap(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"main.go": `package main
+
+func load() (int, error) { return 0, nil }
+
+func Load() (int, error) {
+	n, err := load() // @inco: err == nil, -return(0, err), -wrap("load user")
+	_, err = load()  // @inco: err == nil, -wrap("reload")
+	_, err = load()  // @inco: err == nil, -return(0, err), -wrap("100% bad")
+	return n, nil
+}
+`,
+		"go.mod": "module example.com/m\n\ngo 1.22\n",
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	shadow := readShadow(t, e)
+	for _, want := range []string{
+		`return 0, fmt.Errorf("load user: %w", err)`,
+		`panic(fmt.Errorf("reload: %w", err))`,
+		`return 0, fmt.Errorf("100%% bad: %w", err)`,
+		`"fmt"`,
+	} {
+		if !strings.Contains(shadow, want) {
+			t.Errorf("missing %q in:\n%s", want, shadow)
+		}
+	}
+	cmd := exec.Command("go", "vet", "-overlay", e.OverlayPath(), ".")
+	cmd.Dir = dir
+	if msg, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("go vet: %v\n%s", err, msg)
+	}
+}
+
+func TestEngine_Except(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"go.mod": "module example.com/m\n\ngo 1.21\n",
+		"main.go": `package main
+
+import "bufio"
+
+func Next(r *bufio.Reader) error {
+	_, err := r.ReadByte() // @inco: err == nil, -return(err), -except(io.EOF), -wrap("read")
+	return nil
+}
+`,
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	shadow := readShadow(t, e)
+	for _, want := range []string{
+		`if !((err == nil) || errors.Is(err, io.EOF)) {`,
+		`return fmt.Errorf("read: %w", err)`,
+		`"errors"`,
+		`"io"`,
+	} {
+		if !strings.Contains(shadow, want) {
+			t.Errorf("missing %q in:\n%s", want, shadow)
+		}
+	}
+}
+
+func TestEngine_Retry(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"main.go": `package main
+
+func fetch(string) (int, error) { return 0, nil }
+
+func Get(u string) (int, error) {
+	n, err := fetch(u) // @inco: err == nil, -return(0, err), -retry(3, 10*time.Millisecond)
+	return n, nil
+}
+
+func Standalone() {
+	// @inco: true, -retry(2)
+}
+`,
+	})
+	e := NewEngine(dir)
+	err := e.Run()
+	if err == nil || !strings.Contains(err.Error(), "-retry requires an inline assignment") {
+		t.Fatalf("expected standalone -retry error, got %v", err)
+	}
+
+	writeFile(t, filepath.Join(dir, "main.go"), `package main
+
+func fetch(string) (int, error) { return 0, nil }
+
+func Get(u string) (int, error) {
+	n, err := fetch(u) // @inco: err == nil, -return(0, err), -retry(3, 10*time.Millisecond)
+	return n, nil
+}
+`)
+	e = NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	shadow := readShadow(t, e)
+	want := "\tfor _incoTry := 1; _incoTry < 3 && !(err == nil); _incoTry++ {\n" +
+		"\t\ttime.Sleep(10 * time.Millisecond)\n" +
+		"\t\tn, err = fetch(u)\n" +
+		"\t}\n" +
+		"\tif !(err == nil) {\n" +
+		"\t\treturn 0, err\n"
+	if !strings.Contains(shadow, want) || !strings.Contains(shadow, `"time"`) {
+		t.Errorf("missing retry loop in:\n%s", shadow)
+	}
+}
+
+func TestEngine_DiscardedError(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"go.mod": "module example.com/m\n\ngo 1.22\n",
+		"main.go": `package main
+
+import "io"
+
+func Close(w, r io.Closer) error {
+	var err error
+	w.Close() // @inco: err == nil, -return(err)
+	_ = r.Close() // @inco: err == nil, -return(err), -wrap("close reader")
+	return err
+}
+
+func main() {}
+`,
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	shadow := readShadow(t, e)
+	for _, want := range []string{
+		"\tif _incoErr := w.Close(); !(_incoErr == nil) {\n\t\treturn _incoErr\n\t}\n",
+		"\tif _incoErr := r.Close(); !(_incoErr == nil) {\n\t\treturn fmt.Errorf(\"close reader: %w\", _incoErr)\n",
+	} {
+		if !strings.Contains(shadow, want) {
+			t.Errorf("missing %q in:\n%s", want, shadow)
+		}
+	}
+	if strings.Contains(shadow, "\tw.Close() //") || strings.Contains(shadow, "_ = r.Close()") {
+		t.Errorf("discarding statements should be replaced:\n%s", shadow)
+	}
+	if ds := e.Diagnostics(); len(ds) != 0 {
+		t.Errorf("unexpected diagnostics: %v", ds)
+	}
+	cmd := exec.Command("go", "vet", "-overlay", e.OverlayPath(), ".")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go vet: %v\n%s\n%s", err, out, shadow)
+	}
+}
+
+func TestEngine_DiscardedErrorNotSingle(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"go.mod": "module example.com/m\n\ngo 1.22\n",
+		"main.go": `package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+func F(mu *sync.Mutex) error {
+	var err error
+	mu.Unlock() // @inco: err == nil, -return(err)
+	fmt.Println("done") // @inco: err == nil, -return(err)
+	return err
+}
+
+func main() {}
+`,
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	shadow := readShadow(t, e)
+	for _, want := range []string{
+		"\tmu.Unlock() // @inco: err == nil, -return(err)\n\tif !(err == nil) {\n",
+		"\tfmt.Println(\"done\") // @inco: err == nil, -return(err)\n\tif !(err == nil) {\n",
+	} {
+		if !strings.Contains(shadow, want) {
+			t.Errorf("missing %q in:\n%s", want, shadow)
+		}
+	}
+	var lines []int
+	for _, d := range e.Diagnostics() {
+		if strings.Contains(d.Message, "does not return a single error") {
+			lines = append(lines, d.Line)
+		}
+	}
+	if !slices.Equal(lines, []int{10, 11}) {
+		t.Errorf("warnings on lines %v, want [10 11]: %v", lines, e.Diagnostics())
+	}
+	cmd := exec.Command("go", "vet", "-overlay", e.OverlayPath(), ".")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go vet: %v\n%s\n%s", err, out, shadow)
+	}
+}
+
+func TestEngine_DiscardedErrorRetyped(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"go.mod":  "module example.com/m\n\ngo 1.22\n",
+		"done.go": "package main\n\nfunc done() {}\n",
+		"main.go": `package main
+
+func F() error {
+	var err error
+	done() // @inco: err == nil, -return(err)
+	return err
+}
+`,
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if shadow := readShadow(t, e); strings.Contains(shadow, "_incoErr") {
+		t.Fatalf("a call without results should not be bound:\n%s", shadow)
+	}
+	writeFile(t, filepath.Join(dir, "done.go"), "package main\n\nfunc done() error { return nil }\n")
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(e.Overlay.Replace[filepath.Join(dir, "main.go")])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shadow := string(data); !strings.Contains(shadow, "\tif _incoErr := done(); !(_incoErr == nil) {\n") {
+		t.Errorf("the shadow should follow the new result type:\n%s", shadow)
+	}
+}
+
+func TestEngine_InitStatement(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"main.go": `package main
+
+func do() (bool, error) { return true, nil }
+
+func F() error {
+	if ok, err := do(); ok { // @inco: err == nil, -return(err)
+		return nil
+	} else if n, err := do(); n { // @inco: err == nil, -return(err)
+		return nil
+	}
+	switch ok, err := do(); ok { // @inco: err == nil, -return(err)
+	case true:
+	}
+	return nil
+}
+`,
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	shadow := readShadow(t, e)
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "shadow.go", shadow, 0)
+	if err != nil {
+		t.Fatalf("shadow does not parse: %v\n%s", err, shadow)
+	}
+	for _, want := range []string{
+		"\t\tok, err := do()\n\t\tif !(err == nil) {\n\t\t\treturn err\n\t\t}\n",
+		"\t\t} else {\n",
+		"\t\t\tn, err := do()\n",
+		"\t\tswitch ok { //",
+	} {
+		if !strings.Contains(shadow, want) {
+			t.Errorf("missing %q in:\n%s", want, shadow)
+		}
+	}
+	// The moved init statements keep the lines of their headers.
+	var lines []int
+	ast.Inspect(f, func(n ast.Node) bool {
+		if as, ok := n.(*ast.AssignStmt); ok && as.Tok == token.DEFINE {
+			lines = append(lines, fset.Position(as.Pos()).Line)
+		}
+		return true
+	})
+	if want := []int{6, 8, 11}; !slices.Equal(lines, want) {
+		t.Errorf("init statements at lines %v, want %v:\n%s", lines, want, shadow)
+	}
+}
+
+func TestEngine_InitStatementLineDirective(t *testing.T) {
+	// Released code carries //line directives. The if below is mapped to
+	// the line of the inline directive above it, whose text it must not be
+	// split by.
+	dir := setupDir(t, map[string]string{
+		"main.go": `package main
+
+func do() (bool, error) { return true, nil }
+
+func F(b bool) error {
+	g() // @inco: b
+//line main.go:6
+	if ok, err := do(); ok {
+		return err
+	}
+	return nil
+}
+
+func g() {}
+`,
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if shadow := readShadow(t, e); !strings.Contains(shadow, "\tif ok, err := do(); ok {") {
+		t.Errorf("if statement rewritten:\n%s", shadow)
+	}
+}
+
+func TestEngine_LoopHeader(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"main.go": `package main
+
+func Sum(xs []*int) (n int) {
+	for _, x := range xs { // @inco: x != nil, -continue
+		n += *x
+	}
+	for i := 0; // @inco: i < 8, -break
+		i < len(xs);
+		i++ {
+		n++
+	}
+	return n
+}
+`,
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	shadow := readShadow(t, e)
+	if _, err := parser.ParseFile(token.NewFileSet(), "shadow.go", shadow, 0); err != nil {
+		t.Fatalf("shadow does not parse: %v\n%s", err, shadow)
+	}
+	for _, want := range []string{
+		"\tfor _, x := range xs { // @inco: x != nil, -continue\n\t\tif !(x != nil) {\n\t\t\tcontinue\n",
+		"i++ {\n\t\tif !(i < 8) {\n\t\t\tbreak\n",
+	} {
+		if !strings.Contains(shadow, want) {
+			t.Errorf("missing %q in:\n%s", want, shadow)
+		}
+	}
+}
+
+func TestEngine_MultipleErrors(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"go.mod": "module example.com/m\n\ngo 1.22\n",
+		"main.go": `package main
+
+func both() (err1, err2 error) { return nil, nil }
+
+func triple() (n int, errA, errB error) { return 0, nil, nil }
+
+func unnamed() (error, error) { return nil, nil }
+
+func F() (int, error) {
+	both() // @inco: err1 == nil && err2 == nil, -return(0, err2), -wrap("both")
+	triple() // @inco: errB == nil && errA == nil, -return(0, errA)
+	n, errA, errB := triple() // @inco: errA == nil && errB == nil, -return(0, errA), -wrap("triple")
+	var err1, err2 error
+	unnamed() // @inco: err1 == nil && err2 == nil, -return(0, err1)
+	return n, nil
+}
+
+func main() {}
+`,
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	shadow := readShadow(t, e)
+	for _, want := range []string{
+		"if _incoErr1, _incoErr2 := both(); !(_incoErr1 == nil && _incoErr2 == nil) {",
+		`return 0, fmt.Errorf("both: %w", errors.Join(_incoErr1, _incoErr2))`,
+		"if _, _incoErr1, _incoErr2 := triple(); !(_incoErr2 == nil && _incoErr1 == nil) {",
+		"return 0, errors.Join(_incoErr2, _incoErr1)",
+		`return 0, fmt.Errorf("triple: %w", errors.Join(errA, errB))`,
+		"\tunnamed() // @inco: err1 == nil && err2 == nil, -return(0, err1)\n\tif !(err1 == nil && err2 == nil) {\n\t\treturn 0, errors.Join(err1, err2)\n",
+		`"errors"`,
+	} {
+		if !strings.Contains(shadow, want) {
+			t.Errorf("missing %q in:\n%s", want, shadow)
+		}
+	}
+	var lines []int
+	for _, d := range e.Diagnostics() {
+		if strings.Contains(d.Message, "does not return errors named") {
+			lines = append(lines, d.Line)
+		}
+	}
+	if !slices.Equal(lines, []int{14}) {
+		t.Errorf("warnings on lines %v, want [14]: %v", lines, e.Diagnostics())
+	}
+	cmd := exec.Command("go", "vet", "-overlay", e.OverlayPath(), ".")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go vet: %v\n%s\n%s", err, out, shadow)
+	}
+}
+
+func TestEngine_ConcurrentRoots(t *testing.T) {
+	const n = 4
+	dirs := make([]string, n)
+	for i := range dirs {
+		dirs[i] = setupDir(t, map[string]string{
+			"main.go":  "package main\n\nfunc F(p *int) {\n\t// @inco: p != nil\n}\n",
+			"sub/s.go": "package sub\n\nfunc G(s string) {\n\t// @inco: -len(1) s\n}\n",
+		})
+	}
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i, dir := range dirs {
+		wg.Add(1)
+		go func(i int, dir string) {
+			defer wg.Done()
+			e := NewEngine(dir)
+			for j := 0; j < 3 && errs[i] == nil; j++ {
+				errs[i] = e.Run()
+			}
+		}(i, dir)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("root %d: %v", i, err)
+		}
+		data, err := os.ReadFile(filepath.Join(dirs[i], ".inco_cache", "overlay.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got Overlay
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatal(err)
+		}
+		if len(got.Replace) != 2 {
+			t.Errorf("root %d: expected 2 overlay entries, got %d", i, len(got.Replace))
+		}
+		for src := range got.Replace {
+			if !strings.HasPrefix(src, dirs[i]) {
+				t.Errorf("root %d: overlay entry %s leaked from another root", i, src)
+			}
+		}
+	}
+}
+
+func TestEngine_ConcurrentSameEngine(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"main.go": "package main\n\nfunc F(p *int) {\n\t// @inco: p != nil\n}\n",
+	})
+	e := NewEngine(dir)
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+	for i := 0; i < 4; i++ {
+		wg.Add(4)
+		go func() {
+			defer wg.Done()
+			errs <- e.Run()
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := e.GenerateFile(filepath.Join(dir, "main.go"))
+			errs <- err
+		}()
+		go func() {
+			defer wg.Done()
+			ov, stats := e.Result()
+			if len(ov.Replace) != stats.Mapped {
+				errs <- fmt.Errorf("Result: %d entries, stats %+v", len(ov.Replace), stats)
+				return
+			}
+			errs <- nil
+		}()
+		go func() {
+			defer wg.Done()
+			errs <- e.Export(t.TempDir())
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, stats := e.Result(); stats.Mapped != 1 {
+		t.Errorf("expected 1 mapped file, got %+v", stats)
+	}
+}
+
+func TestEngine_DisableRegion(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"main.go": `package main
+
+func F(dst, src []byte) {
+	//inco:disable
+	// @inco: len(dst) >= len(src)
+	copy(dst, src)
+	//inco:enable
+	// @inco: len(src) > 0
+}
+`,
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	shadow := readShadow(t, e)
+	if strings.Contains(shadow, "!(len(dst) >= len(src))") {
+		t.Errorf("directive in disabled region should be ignored:\n%s", shadow)
+	}
+	if !strings.Contains(shadow, "!(len(src) > 0)") {
+		t.Errorf("directive after //inco:enable should be processed:\n%s", shadow)
+	}
+}
+
+func TestEngine_SkipFunction(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"main.go": `package main
+
+//inco:skip
+func Fast(p *int) int {
+	return *p // @inco: p != nil
+}
+
+func Safe(p *int) int {
+	// @inco: p != nil
+	return *p
+}
+`,
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	shadow := readShadow(t, e)
+	if n := strings.Count(shadow, "!(p != nil)"); n != 1 {
+		t.Errorf("expected only Safe to be guarded, got %d guards:\n%s", n, shadow)
+	}
+}
+
+func TestEngine_DefaultActionPragma(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"main.go": `package main
+
+//inco:default -return(0)
+
+func F(x int) int {
+	// @inco: x > 0
+	// @inco: x < 100, -panic("too big")
+	return x
+}
+`,
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	shadow := readShadow(t, e)
+	for _, want := range []string{"if !(x > 0) {\n\t\treturn 0\n\t}", `panic("too big")`} {
+		if !strings.Contains(shadow, want) {
+			t.Errorf("missing %q in:\n%s", want, shadow)
+		}
+	}
+}
+
+func TestEngine_DefaultActionPragmaInvalid(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"main.go": "package main\n\n//inco:default -bogus\n\nfunc F(x int) {\n\t// @inco: x > 0\n}\n",
+	})
+	e := NewEngine(dir)
+	err := e.Run()
+	if err == nil || !strings.Contains(err.Error(), "main.go:3: invalid //inco:default") {
+		t.Fatalf("expected invalid pragma error, got %v", err)
+	}
+}
+
+func TestEngine_Ensure(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"main.go": `package main
+
+func Load(id string) (res *int, n int, err error) {
+	// @inco: res != nil, -onsuccess
+	// @inco: res == nil, -log, -onerror
+	// @inco: n >= 0, -ensure
+	return nil, 0, nil
+}
+`,
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	shadow := readShadow(t, e)
+	for _, want := range []string{
+		"defer func() {\n\t\tif err == nil && !(res != nil) {\n\t\t\tpanic(",
+		"defer func() {\n\t\tif err != nil && !(res == nil) {\n\t\t\tlog.Println(",
+		"defer func() {\n\t\tif !(n >= 0) {",
+	} {
+		if !strings.Contains(shadow, want) {
+			t.Errorf("missing %q in:\n%s", want, shadow)
+		}
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "shadow.go", shadow, 0); err != nil {
+		t.Fatalf("shadow does not parse: %v\n%s", err, shadow)
+	}
+
+	writeFile(t, filepath.Join(dir, "main.go"), "package main\n\nfunc F() (int, error) {\n\t// @inco: true, -onsuccess\n\treturn 0, nil\n}\n")
+	if err := NewEngine(dir).Run(); err == nil || !strings.Contains(err.Error(), "-onsuccess requires a named error result") {
+		t.Errorf("expected named error result error, got %v", err)
+	}
+}
+
+func TestEngine_PackageLevel(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"main.go": `package main
+
+import "encoding/json"
+
+var raw = []byte(` + "`" + `{"port": 80}` + "`" + `)
+
+var cfg struct{ Port int }
+
+var cfgErr = json.Unmarshal(raw, &cfg) // @inco: cfgErr == nil, -panic(cfgErr)
+
+// @inco: cfg.Port > 0
+
+func init() {
+	// @inco: len(raw) > 0
+}
+
+var handler = func(n int) {
+	// @inco: n >= 0
+}
+`,
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	shadow := readShadow(t, e)
+	for _, want := range []string{
+		"func init() {\n//line " + filepath.Join(dir, "main.go") + ":9\n\tif !(cfgErr == nil) {\n\t\tpanic(cfgErr)\n\t}\n//line " + filepath.Join(dir, "main.go") + ":11\n\tif !(cfg.Port > 0) {",
+		"\tif !(len(raw) > 0) {",
+		"\tif !(n >= 0) {",
+	} {
+		if !strings.Contains(shadow, want) {
+			t.Errorf("missing %q in:\n%s", want, shadow)
+		}
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "shadow.go", shadow, 0); err != nil {
+		t.Fatalf("shadow does not parse: %v\n%s", err, shadow)
+	}
+}
+
+func TestEngine_ExportedOnly(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"main.go": `package main
+
+type Server struct{}
+
+type conn struct{}
+
+func Serve(n int) {
+	// @inco: n > 0
+}
+
+func (s *Server) Handle(id string) {
+	// @inco: id != ""
+}
+
+// helper is internal.
+func helper(x int) {
+	// @inco: x >= 0
+}
+
+func (c *conn) Write(p []byte) {
+	// @inco: len(p) > 0
+}
+`,
+	})
+	e := NewEngine(dir)
+	e.Config.ExportedOnly = true
+	var warnings []string
+	e.OnWarning = func(d Diagnostic) { warnings = append(warnings, d.String()) }
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	shadow := readShadow(t, e)
+	for _, want := range []string{"if !(n > 0) {", `if !(id != "") {`} {
+		if !strings.Contains(shadow, want) {
+			t.Errorf("missing %q in:\n%s", want, shadow)
+		}
+	}
+	for _, unwanted := range []string{"if !(x >= 0) {", "if !(len(p) > 0) {"} {
+		if strings.Contains(shadow, unwanted) {
+			t.Errorf("unexpected %q in:\n%s", unwanted, shadow)
+		}
+	}
+	path := filepath.Join(dir, "main.go")
+	want := []string{
+		path + ":17: directive in unexported function helper ignored (exported_only)",
+		path + ":21: directive in unexported function conn.Write ignored (exported_only)",
+	}
+	if !reflect.DeepEqual(warnings, want) {
+		t.Errorf("warnings = %q, want %q", warnings, want)
+	}
+
+	// Cached shadows repeat their warnings.
+	warnings = nil
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(warnings, want) {
+		t.Errorf("cached warnings = %q, want %q", warnings, want)
+	}
+}
+
+func TestEngine_Funcs(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"main.go": `package main
+
+type API struct{}
+
+func HandleGet(id string) {
+	// @inco: id != ""
+}
+
+func (a *API) ServeHTTP(n int) {
+	// @inco: n > 0
+}
+
+func parse(s string) {
+	// @inco: len(s) < 64
+}
+
+func GetAll(k string) {
+	// @inco: k != "*"
+}
+`,
+	})
+	e := NewEngine(dir)
+	e.Config.Funcs = []string{"Handle.*", `API\.Serve.*`, "Get"}
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	shadow := readShadow(t, e)
+	for _, want := range []string{`if !(id != "") {`, "if !(n > 0) {"} {
+		if !strings.Contains(shadow, want) {
+			t.Errorf("missing %q in:\n%s", want, shadow)
+		}
+	}
+	// Patterns match whole names: "Get" does not select GetAll.
+	for _, unwanted := range []string{"if !(len(s) < 64) {", `if !(k != "*") {`} {
+		if strings.Contains(shadow, unwanted) {
+			t.Errorf("unexpected %q in:\n%s", unwanted, shadow)
+		}
+	}
+
+	e.Config.Funcs = []string{"Handle("}
+	if err := e.Run(); err == nil || !strings.Contains(err.Error(), `invalid pattern "Handle("`) {
+		t.Fatalf("err = %v, want invalid pattern error", err)
+	}
+}
+
+func TestEngine_Typecheck(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"main.go":  "package main\n\nvar broken int = \"preexisting\"\n\nfunc Count(n int) int {\n\t// @inco: n >= 0, -return(nil)\n\treturn n\n}\n\nfunc main() {}\n",
+		"ok/ok.go": "package ok\n\nimport \"strings\"\n\nfunc Upper(s string) string {\n\t// @inco: s != \"\", -return(\"\")\n\treturn strings.ToUpper(s)\n}\n",
+	})
+	e := NewEngine(dir)
+	e.Config.Typecheck = true
+	err := e.Run()
+	if err == nil {
+		t.Fatal("Run succeeded, want a type error at the directive")
+	}
+	msg := err.Error()
+	if !strings.Contains(msg, filepath.Join(dir, "main.go")+":6: generated code: ") || !strings.Contains(msg, "nil") {
+		t.Errorf("error = %q, want main.go:6 and the nil return", msg)
+	}
+	if strings.Contains(msg, "preexisting") || strings.Contains(msg, "ok.go") {
+		t.Errorf("error = %q, want only errors introduced by generation", msg)
+	}
+	if _, err := os.Stat(e.OverlayPath()); !os.IsNotExist(err) {
+		t.Errorf("overlay written despite the type error: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n\nfunc Count(n int) int {\n\t// @inco: n >= 0, -return(0)\n\treturn n\n}\n\nfunc main() {}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEngine_TypecheckOnlyDirectives(t *testing.T) {
+	// A directory no build can load: were it checked, it would be
+	// reported as not type-checked.
+	dir := setupDir(t, map[string]string{
+		"main.go":    "package main\n\nfunc Count(n int) int {\n\t// @inco: n >= 0, -return(0)\n\treturn n\n}\n\nfunc main() {}\n",
+		"mixed/a.go": "package a\n\nfunc A() {}\n",
+		"mixed/b.go": "package b\n\nfunc B() {}\n",
+	})
+	e := NewEngine(dir)
+	e.Config.Typecheck = true
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range e.Diagnostics() {
+		t.Errorf("unexpected diagnostic: %v", d)
+	}
+
+	// With a directive, it is checked.
+	writeFile(t, filepath.Join(dir, "mixed", "a.go"), "package a\n\nfunc A(n int) {\n\t// @inco: n > 0\n}\n")
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if diags := e.Diagnostics(); len(diags) != 1 || !strings.Contains(diags[0].Message, "package not type-checked") {
+		t.Errorf("diagnostics = %v, want the package reported", diags)
+	}
+}
+
+func TestEngine_TypecheckPlatforms(t *testing.T) {
+	other := "windows/amd64"
+	if runtime.GOOS == "windows" {
+		other = "linux/amd64"
+	}
+	goos, _, _ := strings.Cut(other, "/")
+	dir := setupDir(t, map[string]string{
+		"p.go":              "package p\n\nfunc Count(n int) int {\n\t// @inco: n >= 0, -return(0)\n\treturn n\n}\n",
+		"p_" + goos + ".go": "package p\n\nimport \"os\"\n\nfunc Pid() int {\n\t// @inco: os.Getpid() > 0, -return(nil)\n\treturn os.Getpid()\n}\n",
+	})
+	e := NewEngine(dir)
+	e.Config.Typecheck = true
+	if err := e.Run(); err != nil {
+		t.Fatalf("host-only typecheck: %v", err)
+	}
+
+	e = NewEngine(dir)
+	e.Config.Typecheck = true
+	e.Config.Platforms = []string{runtime.GOOS + "/" + runtime.GOARCH, other}
+	err := e.Run()
+	want := filepath.Join(dir, "p_"+goos+".go") + ":6: generated code for " + other + ": "
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("error = %v, want %q", err, want)
+	}
+
+	writeFile(t, filepath.Join(dir, ".inco.json"), `{"platforms": ["linux"]}`)
+	if _, err := LoadConfig(dir); err == nil || !strings.Contains(err.Error(), `invalid platform "linux"`) {
+		t.Errorf("LoadConfig error = %v, want invalid platform", err)
+	}
+}
+
+func TestEngine_StaticConditions(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"go.mod": "module example.com/m\n\ngo 1.22\n",
+		"main.go": `package main
+
+const debug = false
+
+func F(s []int, u uint, n int) {
+	// @inco: len(s) >= 0
+	// @inco: -nonneg u
+	// @inco: cap(s) < 0 && n > 0
+	// @inco: debug
+	// @inco: n > 0 || 0 <= len(s)
+	// @inco: len(s) > 0 && n >= 0
+}
+
+func main() {}
+`,
+	})
+	e := NewEngine(dir)
+	e.Config.Typecheck = true
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, d := range e.Diagnostics() {
+		got = append(got, fmt.Sprintf("%d: %s", d.Line, d.Message))
+	}
+	want := []string{
+		"6: condition len(s) >= 0 is always true: the check never fails",
+		"7: condition u >= 0 is always true: the check never fails",
+		"8: condition cap(s) < 0 && n > 0 is always false: the check always fails",
+		"9: condition debug is always false: the check always fails",
+		"10: condition n > 0 || 0 <= len(s) is always true: the check never fails",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("warnings:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	e.Buffers = map[string][]byte{filepath.Join(dir, "main.go"): []byte("package main\n\nfunc F(s string) {\n\t// @inco: len(s) >= 0\n}\n\nfunc main() {}\n")}
+	if diags := e.lintFile(context.Background(), filepath.Join(dir, "main.go")); len(diags) != 1 || diags[0].Line != 4 || !strings.Contains(diags[0].Message, "always true") {
+		t.Errorf("lint diagnostics = %v, want the always-true condition at line 4", diags)
+	}
+}
+
+func TestEngine_CallSiteContracts(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"go.mod": "module example.com/m\n\ngo 1.22\n",
+		"store/store.go": `package store
+
+type User struct{ Name string }
+
+type DB struct{}
+
+func Save(u *User, name string, n int) {
+	// @inco: -nd u
+	// @inco: name != "" && n > 0
+}
+
+func (db *DB) Get(id int, opts ...string) {
+	// @inco: -pos id
+	// @inco: -nd opts
+	// @inco[debug]: db != nil
+}
+`,
+		"main.go": `package main
+
+import "example.com/m/store"
+
+func main() {
+	var db *store.DB
+	store.Save(nil, "", 0)
+	store.Save(&store.User{}, "x", 0)
+	db.Get(0)
+	db.Get(1, "")
+	local(store.User{})
+}
+
+func local(u store.User) {
+	// @inco: -nd u
+}
+`,
+	})
+	t.Chdir(dir) // the source importer resolves the module from the working directory
+	e := NewEngine(dir)
+	e.Config.Typecheck = true
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, d := range e.Diagnostics() {
+		rel, _ := filepath.Rel(dir, d.Path)
+		got = append(got, fmt.Sprintf("%s:%d: %s", filepath.ToSlash(rel), d.Line, d.Message))
+	}
+	want := []string{
+		`main.go:7: call to Save passes nil for u, which "-nd u" at store.go:8 rejects`,
+		`main.go:7: call to Save passes "" for name, which "name != \"\"" at store.go:9 rejects`,
+		`main.go:9: call to Get passes 0 for id, which "-pos id" at store.go:13 rejects`,
+		`main.go:11: call to local passes store.User{} for u, which "-nd u" at main.go:15 rejects`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("warnings:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestEngine_IncludeTests(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"go.mod": "module example.com/m\n\ngo 1.22\n",
+		"p/p.go": "package p\n\nfunc Abs(n int) int {\n\tif n < 0 {\n\t\treturn -n\n\t}\n\treturn n\n}\n",
+		"p/p_test.go": `package p
+
+import "testing"
+
+func half(n int) int {
+	// @inco: n%2 == 0
+	return n / 2
+}
+
+func TestHalf(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("half(3) did not panic")
+		}
+	}()
+	half(Abs(3))
+}
+`,
+		"p/ext_test.go": "package p_test\n\nimport \"example.com/m/p\"\n\nfunc abs(n int) int {\n\t// @inco: n > -100, -return(nil)\n\treturn p.Abs(n)\n}\n",
+	})
+	t.Chdir(dir)
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if len(e.Overlay.Replace) != 1 {
+		t.Errorf("overlay = %v, want only p.go without include_tests", e.Overlay.Replace)
+	}
+
+	e.Config.IncludeTests = true
+	e.Config.Typecheck = true
+	err := e.Run()
+	want := filepath.Join(dir, "p", "ext_test.go") + ":6: generated code: "
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Fatalf("error = %v, want %q", err, want)
+	}
+
+	writeFile(t, filepath.Join(dir, "p", "ext_test.go"), "package p_test\n\nimport \"example.com/m/p\"\n\nfunc abs(n int) int {\n\t// @inco: n > -100, -return(0)\n\treturn p.Abs(n)\n}\n")
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if len(e.Overlay.Replace) != 3 {
+		t.Errorf("overlay = %v, want the test files too", e.Overlay.Replace)
+	}
+	cmd := exec.Command("go", "test", "-overlay", e.OverlayPath(), "./...")
+	cmd.Dir = dir
+	if msg, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go test: %v\n%s", err, msg)
+	}
+}
+
+func TestEngine_IncludeTestsGateTag(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		".inco.json": `{"include_tests": true, "gate_tag": "inco_off"}`,
+		"go.mod":     "module example.com/m\n\ngo 1.22\n",
+		"p/p.go":     "package p\n\nfunc Abs(n int) int {\n\tif n < 0 {\n\t\treturn -n\n\t}\n\treturn n\n}\n",
+		"p/ext_test.go": `package p_test
+
+import (
+	"testing"
+
+	"example.com/m/p"
+)
+
+func half(n int) int {
+	// @inco: n%2 == 0
+	return n / 2
+}
+
+func TestHalf(t *testing.T) {
+	if half(p.Abs(-4)) != 2 {
+		t.Error("half(4) != 2")
+	}
+}
+`,
+	})
+	goTest := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("go", append([]string{"test", "-overlay", filepath.Join(dir, ".inco_cache", "overlay.json")}, append(args, "./...")...)...)
+		cmd.Dir = dir
+		if msg, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("go test %v: %v\n%s", args, err, msg)
+		}
+	}
+
+	// Only the external test package has guards: its gates are test files.
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"inco_checks_on_test.go", "inco_checks_off_test.go"} {
+		if _, ok := e.Overlay.Replace[filepath.Join(dir, "p", name)]; !ok {
+			t.Errorf("overlay has no %s: %v", name, e.Overlay.Replace)
+		}
+	}
+	if _, ok := e.Overlay.Replace[filepath.Join(dir, "p", "inco_checks_on.go")]; ok {
+		t.Error("package p has no guards but got a gate")
+	}
+	goTest()
+	goTest("-tags", "inco_off")
+
+	// Guards in p and p_test: each package gets its own gates.
+	writeFile(t, filepath.Join(dir, "p", "p.go"), "package p\n\nfunc Abs(n int) int {\n\t// @inco: n > -100\n\tif n < 0 {\n\t\treturn -n\n\t}\n\treturn n\n}\n")
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"inco_checks_on.go", "inco_checks_off.go", "inco_checks_on_test.go", "inco_checks_off_test.go"} {
+		if _, ok := e.Overlay.Replace[filepath.Join(dir, "p", name)]; !ok {
+			t.Errorf("overlay has no %s: %v", name, e.Overlay.Replace)
+		}
+	}
+	goTest()
+	goTest("-tags", "inco_off")
+}
+
+func TestEngine_SlogLogger(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"main.go": "package main\n\nfunc f(p *int) {\n\t// @inco: p != nil\n}\n\nfunc Count(n int) int {\n\t// @inco: n >= 0, -return(nil)\n\treturn n\n}\n",
+	})
+	var buf strings.Builder
+	e := NewEngine(dir)
+	e.Config.ExportedOnly = true
+	e.Logger = slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"level=DEBUG msg=file path=" + filepath.Join(dir, "main.go") + " directives=1 cached=false",
+		"level=WARN msg=\"directive in unexported function f ignored (exported_only)\" path=" + filepath.Join(dir, "main.go") + " line=4",
+		"level=INFO msg=\"run complete\"",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("log missing %q:\n%s", want, buf.String())
+		}
+	}
+
+	buf.Reset()
+	e.Config.Typecheck = true
+	if err := e.Run(); err == nil {
+		t.Fatal("want a type error")
+	}
+	for _, want := range []string{"level=ERROR msg=\"generated code: ", " line=8", "level=ERROR msg=\"run failed\""} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("log missing %q:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestEngine_Diagnostics(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"main.go": "package main\n\nfunc F(x int) {\n\t// @inco: x > 0, -retry(1, 2, 3)\n\t// @inco: x >\n\t// @inco: x > 0\n}\n",
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "main.go")
+	got := e.Diagnostics()
+	if len(got) != 2 || got[0].Path != path || got[0].Line != 4 || !strings.Contains(got[0].Message, "malformed directive ignored") ||
+		got[1].Line != 5 || !strings.Contains(got[1].Message, "is not a Go expression") {
+		t.Fatalf("Diagnostics() = %v, want a malformed directive at 4 and a bad condition at 5", got)
+	}
+
+	// Cached runs keep the warnings; strict mode fails on them and leaves
+	// the previous overlay in place.
+	e.Config.Strict = true
+	err := e.Run()
+	if err == nil || !strings.Contains(err.Error(), "2 warning(s) in strict mode") || !strings.Contains(err.Error(), path+":4: ") {
+		t.Fatalf("strict Run = %v, want the warnings", err)
+	}
+	if ov, _ := e.Result(); len(ov.Replace) != 1 {
+		t.Errorf("overlay = %v, want the previous run's", ov.Replace)
+	}
+}
+
+func TestEngine_StrayOptions(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"main.go": `package main
+
+func F(x int) error {
+	// @inco: x > 0, -ret(nil)
+	// @inco: x > 1, -return(fmt.Errorf("x"
+	// @inco: f(x, -x) > 0
+	return nil
+}
+
+func f(a, b int) int { return a + b }
+`,
+	})
+	e := NewEngine(dir)
+	e.Config.Strict = true
+	err := e.Run()
+	if err == nil {
+		t.Fatal("strict Run succeeded, want the stray options")
+	}
+	for _, want := range []string{
+		`main.go:4: unknown option -ret`,
+		`main.go:5: option -return(fmt.Errorf("x" does not parse`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("strict Run = %v, want %q", err, want)
+		}
+	}
+	if strings.Contains(err.Error(), "main.go:6:") {
+		t.Errorf("strict Run = %v, want no warning for a negative argument", err)
+	}
+}
+
+func TestEngine_OrphanedDirectives(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"main.go": `package main
+
+import "fmt" // @inco: true
+
+type T struct {
+	A int // @inco: A > 0
+}
+
+func F(x int) string { // @inco: x > 0
+	s := fmt.Sprint(
+		x, // @inco: x > 1
+	)
+	if x > 2 {
+		return s
+	} // @inco: x > 3
+	return s // @inco: x > 4
+}
+
+var v = 1 // @inco: v > 0
+`,
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	var lines []int
+	for _, d := range e.Diagnostics() {
+		if !strings.Contains(d.Message, "orphaned directive ignored") {
+			t.Errorf("unexpected warning %v", d)
+		}
+		lines = append(lines, d.Line)
+	}
+	if fmt.Sprint(lines) != "[3 6 9 11 15]" {
+		t.Errorf("orphaned directives at %v, want [3 6 9 11 15]", lines)
+	}
+	if shadow := readShadow(t, e); !strings.Contains(shadow, "if !(x > 4)") || !strings.Contains(shadow, "if !(v > 0)") {
+		t.Errorf("attached directives must still generate:\n%s", shadow)
+	}
+
+	e.Config.Strict = true
+	if err := e.Run(); err == nil || !strings.Contains(err.Error(), "5 warning(s) in strict mode") {
+		t.Errorf("strict Run = %v, want the orphaned directives", err)
+	}
+}
+
+func TestEngine_RedundantDirectives(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"main.go": `package main
+
+type U struct{ Name string }
+
+func F(u *U, n int, xs []int) {
+	// @inco: -nd u
+	// @inco: u != nil
+	// @inco: n > 0, -return
+	// @inco: n >= 0
+	if n > 3 {
+		// @inco: n != 0 && u != nil
+	}
+	// @inco: len(xs) > 0
+	xs = append(xs, 1)
+	// @inco: len(xs) > 0
+	for i := 0; i < 3; i++ {
+		// @inco: n > 1
+		n--
+	}
+	// @inco: n > 1, -log("n")
+	// @inco: n > 1
+	// @inco: n >= 1
+	// @inco: n > 2, -return
+	// @inco: n > 2, -return
+	// @inco: n > 3, -panic("a")
+	// @inco: n > 3, -panic("b")
+	// @inco: u.Name != ""
+	u.Name = ""
+	// @inco: u.Name != ""
+	go func() {
+		// @inco: u.Name != ""
+	}()
+}
+`,
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, d := range e.Diagnostics() {
+		got = append(got, fmt.Sprintf("%d: %s", d.Line, d.Message))
+	}
+	want := []string{
+		"7: directive never fails: u != nil is already checked at line 6",
+		"9: directive never fails: n >= 0 is already checked at line 8",
+		"11: directive never fails: n != 0 && u != nil is already checked at lines 7 and 8",
+		"24: duplicate directive: n > 2 is already checked at line 23",
+		"26: directive never fails: n > 3 is already checked at line 25",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("warnings:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestEngine_ContinueOnError(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"a/a.go": "package a\n\nfunc A(p *int) {\n\t// @inco: p != nil\n}\n",
+		"b/b.go": "package b\n\nfunc B( {\n",
+		"c/c.go": "package c\n\nfunc C(n int) {\n\t// @inco: n > 0, -break(L)\n}\n",
+		"d/d.go": "package d\n\nfunc D(n int) int {\n\t// @inco: n > 0, -return(nil)\n\treturn n\n}\n",
+		"e/e.go": "package e\n\nfunc E(p *int) {\n\t// @inco: p != nil\n}\n",
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err == nil {
+		t.Fatal("Run succeeded, want the first error")
+	}
+
+	var failed []string
+	e.ContinueOnError = true
+	e.Config.Typecheck = true
+	e.OnFileDone = func(ev FileEvent) {
+		if ev.Err != nil {
+			failed = append(failed, filepath.Base(ev.Path))
+		}
+	}
+	report, err := e.RunReport(context.Background())
+	if err == nil {
+		t.Fatal("RunReport succeeded, want the joined file errors")
+	}
+	for _, want := range []string{"parse " + filepath.Join(dir, "b", "b.go"), filepath.Join(dir, "c", "c.go") + ":4: -break(L)", filepath.Join(dir, "d", "d.go") + ":4: generated code: "} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error missing %q:\n%v", want, err)
+		}
+	}
+	if report.FilesFailed != 3 {
+		t.Errorf("FilesFailed = %d, want 3", report.FilesFailed)
+	}
+	sort.Strings(failed)
+	if !reflect.DeepEqual(failed, []string{"b.go", "c.go"}) {
+		t.Errorf("failed events = %v, want b.go and c.go (d.go fails after generation)", failed)
+	}
+	ov, _ := e.Result()
+	if len(ov.Replace) != 2 || ov.Replace[filepath.Join(dir, "a", "a.go")] == "" || ov.Replace[filepath.Join(dir, "e", "e.go")] == "" {
+		t.Errorf("overlay = %v, want a.go and e.go", ov.Replace)
+	}
+}
+
+func TestEngine_FileLimits(t *testing.T) {
+	var big strings.Builder
+	big.WriteString("package big\n")
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(&big, "\nfunc F%d(p *int) {\n\t// @inco: p != nil\n}\n", i)
+	}
+	dir := setupDir(t, map[string]string{
+		".inco.json": `{"max_file_size": 4096}`,
+		"a/a.go":     "package a\n\nfunc A(p *int) {\n\t// @inco: p != nil\n}\n",
+		"big/big.go": big.String(),
+	})
+	e := NewEngine(dir)
+	report, err := e.RunReport(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bigPath := filepath.Join(dir, "big", "big.go")
+	ov, _ := e.Result()
+	if len(ov.Replace) != 1 || ov.Replace[bigPath] != "" {
+		t.Errorf("overlay = %v, want a.go only", ov.Replace)
+	}
+	if len(report.Warnings) != 1 || report.Warnings[0].Path != bigPath || !strings.Contains(report.Warnings[0].Message, "exceeds max_file_size (4096)") {
+		t.Errorf("warnings = %v, want big.go over max_file_size", report.Warnings)
+	}
+
+	// A file taking longer than file_timeout is skipped the same way.
+	e.Config = Config{FileTimeout: "1ns"}
+	report, err = e.RunReport(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var timedOut bool
+	for _, w := range report.Warnings {
+		timedOut = timedOut || w.Path == bigPath && strings.Contains(w.Message, "exceeded file_timeout (1ns)")
+	}
+	if !timedOut {
+		t.Errorf("warnings = %v, want big.go over file_timeout", report.Warnings)
+	}
+
+	writeFile(t, filepath.Join(dir, ".inco.json"), `{"file_timeout": "soon"}`)
+	if _, err := LoadConfig(dir); err == nil || !strings.Contains(err.Error(), `invalid file_timeout "soon"`) {
+		t.Errorf("LoadConfig error = %v, want invalid file_timeout", err)
+	}
+}
+
+func TestEngine_BuildConstraints(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"w.go": "//go:build windows\n// +build windows\n\npackage p\n\nfunc F(n int) string {\n\t// @inco: n > 0, -return(fmt.Sprint(n))\n\treturn \"\"\n}\n",
+		"l.go": "// Package p.\n\n//go:build !windows\n\npackage p\n\nfunc F(n int) string {\n\t// @inco: n > 0\n\treturn \"\"\n}\n",
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	shadows := make(map[string][]byte)
+	for src, sp := range e.Overlay.Replace {
+		data, err := os.ReadFile(sp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		shadows[filepath.Base(src)] = data
+	}
+	if w := string(shadows["w.go"]); !strings.HasPrefix(w, "//go:build windows\n// +build windows\n\npackage p\n") {
+		t.Errorf("w.go shadow lost its constraint:\n%s", w)
+	}
+	// The go command reads the constraints of the shadow, not the source.
+	for goos, want := range map[string]string{"windows": "w.go", "linux": "l.go"} {
+		ctxt := build.Default
+		ctxt.GOOS = goos
+		ctxt.OpenFile = func(path string) (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(shadows[filepath.Base(path)])), nil
+		}
+		for name := range shadows {
+			ok, err := ctxt.MatchFile(dir, name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != (name == want) {
+				t.Errorf("GOOS=%s: shadow of %s matched = %v", goos, name, ok)
+			}
+		}
+	}
+}
+
+func TestEngine_CgoPreamble(t *testing.T) {
+	preamble := "// #include <stdlib.h>\n// static int twice(int n) { return 2 * n; }\n"
+	dir := setupDir(t, map[string]string{
+		"c.go": "package p\n" + preamble + "import \"C\"\n\nfunc Twice(n int) int {\n\t// @inco: n > 0, -return(len(fmt.Sprint(n)))\n\treturn int(C.twice(C.int(n)))\n}\n",
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	shadow := readShadow(t, e)
+	f, err := parser.ParseFile(token.NewFileSet(), "c.go", shadow, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, decl := range f.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.IMPORT || gd.Specs[0].(*ast.ImportSpec).Path.Value != `"C"` {
+			continue
+		}
+		if gd.Doc == nil || gd.Doc.Text() != "#include <stdlib.h>\nstatic int twice(int n) { return 2 * n; }\n" {
+			t.Errorf("cgo preamble changed:\n%s", shadow)
+		}
+	}
+	if !strings.Contains(shadow, "import \"C\"\n\nimport (\n\t\"fmt\"\n)") {
+		t.Errorf("fmt not imported after import \"C\":\n%s", shadow)
+	}
+}
+
+func TestEngine_Pragmas(t *testing.T) {
+	src := `package p
+
+import (
+	_ "embed"
+	_ "unsafe"
+)
+
+//go:generate echo hi
+func A(n int) int {
+	// @inco: n > 0, -return(len(fmt.Sprint(n)))
+	// @inco: n < 100
+	return n
+}
+
+//go:embed x.txt
+var text string
+
+//go:linkname nanotime runtime.nanotime
+func nanotime() int64
+
+//go:noinline
+func B(n int) int {
+	// @inco: n > 0
+	return n
+}
+
+//go:nosplit
+func C() {}
+`
+	dir := setupDir(t, map[string]string{"p.go": src, "x.txt": "x"})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	shadow := readShadow(t, e)
+	lines := strings.Split(src, "\n")
+	for i, line := range lines {
+		if !strings.HasPrefix(line, "//go:") {
+			continue
+		}
+		// The pragma must still apply to the declaration after it.
+		if want := line + "\n" + lines[i+1] + "\n"; !strings.Contains(shadow, want) {
+			t.Errorf("shadow lacks %q:\n%s", want, shadow)
+		}
+	}
+}
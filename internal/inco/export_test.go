@@ -0,0 +1,53 @@
+package inco
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEngine_Export(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"main.go":    "package main\n\nfunc F(p *int) {\n\t// @inco: p != nil\n}\n",
+		"pkg/lib.go": "package pkg\n\nfunc G(n int) {\n\t// @inco: n > 0\n\t// @inco: n < 10\n}\n",
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	out := t.TempDir()
+	if err := e.Export(out); err != nil {
+		t.Fatal(err)
+	}
+
+	lib, err := os.ReadFile(filepath.Join(out, "pkg", "lib.go"))
+	if err != nil {
+		t.Fatalf("shadow should mirror the source layout: %v", err)
+	}
+	if !strings.Contains(string(lib), "if !(n > 0) {") {
+		t.Errorf("exported file is not the shadow:\n%s", lib)
+	}
+
+	data, err := os.ReadFile(filepath.Join(out, "inco_export.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []ExportEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Path != "main.go" || entries[1].Path != "pkg/lib.go" {
+		t.Fatalf("entries = %+v", entries)
+	}
+	if entries[1].Directives != 2 || entries[1].SrcHash == "" || entries[1].ShadowHash == "" {
+		t.Errorf("incomplete entry: %+v", entries[1])
+	}
+}
+
+func TestEngine_ExportEmptyDir(t *testing.T) {
+	if err := NewEngine(t.TempDir()).Export(""); err == nil {
+		t.Error("expected error for empty export dir")
+	}
+}
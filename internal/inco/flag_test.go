@@ -0,0 +1,642 @@
+package inco
+
+import (
+	"go/parser"
+	"go/token"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// ---------------------------------------------------------------------------
+// parseFlagExpr
+// ---------------------------------------------------------------------------
+
+func TestParseFlagExpr(t *testing.T) {
+	name, args, vars, ok := parseFlagExpr(`-oneof("a,b", f(x, y)) v, w`)
+	if !ok {
+		t.Fatal("parseFlagExpr failed")
+	}
+	if name != "oneof" {
+		t.Errorf("name = %q", name)
+	}
+	if want := []string{`"a,b"`, "f(x, y)"}; !reflect.DeepEqual(args, want) {
+		t.Errorf("args = %v, want %v", args, want)
+	}
+	if want := []string{"v", "w"}; !reflect.DeepEqual(vars, want) {
+		t.Errorf("vars = %v, want %v", vars, want)
+	}
+}
+
+func TestParseFlagExpr_Malformed(t *testing.T) {
+	for _, input := range []string{
+		"-oneof(1, 2", // unbalanced
+		`-oneof("a")`, // no variable
+		"oneof(1) x",  // missing dash
+		"-(1) x",      // missing name
+	} {
+		if _, _, _, ok := parseFlagExpr(input); ok {
+			t.Errorf("parseFlagExpr(%q) should fail", input)
+		}
+	}
+}
+
+// ---------------------------------------------------------------------------
+// -oneof
+// ---------------------------------------------------------------------------
+
+func TestParseDirective_OneOf(t *testing.T) {
+	d := ParseDirective(`// @inco: -oneof("GET", "POST", "PUT") method`)
+	if d == nil {
+		t.Fatal("got nil")
+	}
+	want := `method == "GET" || method == "POST" || method == "PUT"`
+	if d.Expr != want {
+		t.Errorf("Expr = %q, want %q", d.Expr, want)
+	}
+	if d.Flag != "oneof" {
+		t.Errorf("Flag = %q, want oneof", d.Flag)
+	}
+}
+
+func TestParseDirective_OneOfWithAction(t *testing.T) {
+	d := ParseDirective(`// @inco: -oneof(ModeA, ModeB) m, -return(ErrMode)`)
+	if d == nil {
+		t.Fatal("got nil")
+	}
+	if d.Expr != "m == ModeA || m == ModeB" {
+		t.Errorf("Expr = %q", d.Expr)
+	}
+	if d.Action != ActionReturn {
+		t.Errorf("Action = %v, want ActionReturn", d.Action)
+	}
+}
+
+func TestParseDirective_OneOfMultipleVars(t *testing.T) {
+	d := ParseDirective(`// @inco: -oneof(1, 2) a, b`)
+	if d == nil {
+		t.Fatal("got nil")
+	}
+	want := "(a == 1 || a == 2) && (b == 1 || b == 2)"
+	if d.Expr != want {
+		t.Errorf("Expr = %q, want %q", d.Expr, want)
+	}
+}
+
+func TestParseDirective_FlagInvalid(t *testing.T) {
+	for _, input := range []string{
+		"// @inco: -oneof() x",        // no values
+		"// @inco: -oneof(1 +) x",     // bad literal
+		"// @inco: -nosuchflag(1) x",  // unknown flag
+		`// @inco: -oneof("a") x y z`, // bad variable
+	} {
+		if d := ParseDirective(input); d != nil {
+			t.Errorf("ParseDirective(%q) = %+v, want nil", input, d)
+		}
+	}
+}
+
+func TestParseDirective_LeadingMinus(t *testing.T) {
+	for input, expr := range map[string]string{
+		"// @inco: -x < 0":                   "-x < 0",
+		"// @inco: -delta <= 10, -return(0)": "-delta <= 10",
+		"// @inco: -1 < x":                   "-1 < x",
+		"// @inco: -len(xs) > -1":            "-len(xs) > -1",
+	} {
+		d := ParseDirective(input)
+		if d == nil {
+			t.Errorf("ParseDirective(%q) = nil, want the plain condition", input)
+			continue
+		}
+		if d.Expr != expr || d.Flag != "" {
+			t.Errorf("ParseDirective(%q): Expr = %q, Flag = %q; want %q, no flag", input, d.Expr, d.Flag, expr)
+		}
+	}
+	dir := setupDir(t, map[string]string{
+		"main.go": "package main\n\nfunc F(x, delta int) int {\n\t// @inco: -x < 0\n\t// @inco: -delta <= 10, -return(0)\n\t// @inco: -1 < x\n\treturn x\n}\n",
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	shadow := readShadow(t, e)
+	for _, want := range []string{"if !(-x < 0) {", "if !(-delta <= 10) {\n\t\treturn 0", "if !(-1 < x) {"} {
+		if !strings.Contains(shadow, want) {
+			t.Errorf("missing %q in:\n%s", want, shadow)
+		}
+	}
+	if ds := e.Diagnostics(); len(ds) != 0 {
+		t.Errorf("warnings = %v, want none", ds)
+	}
+}
+
+func TestEngine_OneOf(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"main.go": `package main
+
+func Handle(method string) {
+	// @inco: -oneof("GET", "POST") method
+	_ = method
+}
+`,
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	shadow := readShadow(t, e)
+	if !strings.Contains(shadow, `if !(method == "GET" || method == "POST")`) {
+		t.Errorf("shadow should contain membership check, got:\n%s", shadow)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// -match
+// ---------------------------------------------------------------------------
+
+func TestParseDirective_Match(t *testing.T) {
+	d := ParseDirective("// @inco: -match(`^[a-z0-9-]+$`) slug, -return(ErrSlug)")
+	if d == nil {
+		t.Fatal("got nil")
+	}
+	want := "regexp.MustCompile(`^[a-z0-9-]+$`).MatchString(slug)"
+	if d.Expr != want {
+		t.Errorf("Expr = %q, want %q", d.Expr, want)
+	}
+	if d.Action != ActionReturn {
+		t.Errorf("Action = %v, want ActionReturn", d.Action)
+	}
+}
+
+func TestParseDirective_MatchInvalid(t *testing.T) {
+	for _, input := range []string{
+		"// @inco: -match(`[a-`) s",    // bad pattern
+		"// @inco: -match(pat) s",      // not a literal
+		"// @inco: -match(`a`, `b`) s", // too many args
+	} {
+		if d := ParseDirective(input); d != nil {
+			t.Errorf("ParseDirective(%q) = %+v, want nil", input, d)
+		}
+	}
+}
+
+func TestEngine_MatchHoistsRegexp(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"main.go": "package main\n\nfunc A(slug string) {\n" +
+			"\t// @inco: -match(`^[a-z]+$`) slug\n\t_ = slug\n}\n\n" +
+			"func B(name string) {\n" +
+			"\t// @inco: -match(`^[a-z]+$`) name\n\t_ = name\n}\n",
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	shadow := readShadow(t, e)
+	if !strings.Contains(shadow, `_incoRegexp "regexp"`) {
+		t.Errorf("shadow should import regexp, got:\n%s", shadow)
+	}
+	if n := strings.Count(shadow, "= _incoRegexp.MustCompile("); n != 1 {
+		t.Errorf("identical patterns should share one hoisted var, found %d hoisted vars:\n%s", n, shadow)
+	}
+	if !strings.Contains(shadow, ".MatchString(slug)") || !strings.Contains(shadow, ".MatchString(name)") {
+		t.Errorf("shadow should call MatchString on the hoisted var, got:\n%s", shadow)
+	}
+}
+
+func TestEngine_MatchRegexpRenamed(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"go.mod": "module example.com/m\n\ngo 1.22\n",
+		"main.go": "package main\n\nimport re \"regexp\"\n\nvar regexp = re.MustCompile(`\\w+`)\n\n" +
+			"func A(slug string) bool {\n" +
+			"\t// @inco: -match(`^[a-z]+$`) slug\n" +
+			"\treturn regexp.MatchString(slug)\n}\n\nfunc main() {}\n",
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("go", "vet", "-overlay", e.OverlayPath(), ".")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("go vet: %v\n%s\n%s", err, out, readShadow(t, e))
+	}
+}
+
+// ---------------------------------------------------------------------------
+// -len
+// ---------------------------------------------------------------------------
+
+func TestParseDirective_Len(t *testing.T) {
+	d := ParseDirective("// @inco: -len(1, 64) name")
+	if d == nil {
+		t.Fatal("got nil")
+	}
+	if want := "len(name) >= 1 && len(name) <= 64"; d.Expr != want {
+		t.Errorf("Expr = %q, want %q", d.Expr, want)
+	}
+	if want := "len(name) must be in [1, 64]"; d.Desc != want {
+		t.Errorf("Desc = %q, want %q", d.Desc, want)
+	}
+}
+
+func TestParseDirective_LenMinOnly(t *testing.T) {
+	d := ParseDirective("// @inco: -len(1) items, -return(ErrEmpty)")
+	if d == nil {
+		t.Fatal("got nil")
+	}
+	if want := "len(items) >= 1"; d.Expr != want {
+		t.Errorf("Expr = %q, want %q", d.Expr, want)
+	}
+	if d.Action != ActionReturn {
+		t.Errorf("Action = %v, want ActionReturn", d.Action)
+	}
+}
+
+func TestParseDirective_LenInvalid(t *testing.T) {
+	for _, input := range []string{
+		"// @inco: -len name",       // no bounds
+		"// @inco: -len(1, 2, 3) s", // too many bounds
+		"// @inco: -len(1, +) s",    // bad bound
+	} {
+		if d := ParseDirective(input); d != nil {
+			t.Errorf("ParseDirective(%q) = %+v, want nil", input, d)
+		}
+	}
+}
+
+func TestEngine_LenDescriptiveMessages(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"main.go": `package main
+
+func Name(name string) {
+	// @inco: -len(1, 64) name
+	// @inco: -len(1, 64) name, -log
+	_ = name
+}
+`,
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	shadow := readShadow(t, e)
+	if !strings.Contains(shadow, `panic("inco violation: len(name) must be in [1, 64] (at main.go:4)")`) {
+		t.Errorf("panic should use the descriptive message, got:\n%s", shadow)
+	}
+	if !strings.Contains(shadow, `log.Println("inco violation: len(name) must be in [1, 64] (at main.go:5)")`) {
+		t.Errorf("bare -log should log the descriptive message, got:\n%s", shadow)
+	}
+	if !strings.Contains(shadow, `"log"`) {
+		t.Errorf("bare -log should import log, got:\n%s", shadow)
+	}
+}
+
+func TestParseDirective_Is(t *testing.T) {
+	d := ParseDirective("// @inco: -is(validEmail) req.Addr, -return(ErrAddr)")
+	if d == nil {
+		t.Fatal("got nil")
+	}
+	if want := "validEmail(req.Addr)"; d.Expr != want {
+		t.Errorf("Expr = %q, want %q", d.Expr, want)
+	}
+	if d.Flag != "is" || len(d.FlagArgs) != 1 || d.FlagArgs[0] != "validEmail" {
+		t.Errorf("Flag = %q, FlagArgs = %v", d.Flag, d.FlagArgs)
+	}
+	if len(d.FlagVars) != 1 || d.FlagVars[0] != "req.Addr" {
+		t.Errorf("FlagVars = %v, want [req.Addr]", d.FlagVars)
+	}
+}
+
+func TestParseDirective_IsInvalid(t *testing.T) {
+	for _, input := range []string{
+		"// @inco: -is addr",           // no predicate
+		"// @inco: -is(a.b) addr",      // not an identifier
+		"// @inco: -is(valid, x) addr", // too many args
+	} {
+		if d := ParseDirective(input); d != nil {
+			t.Errorf("ParseDirective(%q) = %+v, want nil", input, d)
+		}
+	}
+}
+
+func TestParseDirective_ValidInvalid(t *testing.T) {
+	for _, input := range []string{
+		"// @inco: -valid(x) req", // takes no arguments
+		"// @inco: -valid a, b",   // single variable only
+	} {
+		if d := ParseDirective(input); d != nil {
+			t.Errorf("ParseDirective(%q) = %+v, want nil", input, d)
+		}
+	}
+}
+
+func TestEngine_ValidDefault(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"main.go": `package main
+
+type Req struct{ Name string }
+
+func Create(req Req) error {
+	// @inco: -valid req, -return(err)
+	// @inco: -valid req
+	return nil
+}
+`,
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	shadow := readShadow(t, e)
+	for _, want := range []string{
+		"if err := validator.New().Struct(req); !(err == nil) {\n\t\treturn err\n\t}",
+		`panic("inco violation: req must pass validation (at main.go:7)" + ": " + err.Error())`,
+		`"github.com/go-playground/validator/v10"`,
+	} {
+		if !strings.Contains(shadow, want) {
+			t.Errorf("missing %q in:\n%s", want, shadow)
+		}
+	}
+}
+
+func TestEngine_ValidConfigured(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		".inco.json": `{"validator": {"expr": "check.Struct(%s)", "import": "example.com/app/check"}}`,
+		"main.go": `package main
+
+func Create(req any) {
+	// @inco: -valid req
+	_ = req
+}
+`,
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	shadow := readShadow(t, e)
+	if !strings.Contains(shadow, "if err := check.Struct(req); !(err == nil) {") {
+		t.Errorf("configured validator not used, got:\n%s", shadow)
+	}
+	if !strings.Contains(shadow, `"example.com/app/check"`) || strings.Contains(shadow, "go-playground") {
+		t.Errorf("imports should follow the configured validator, got:\n%s", shadow)
+	}
+}
+
+func TestParseDirective_Nd(t *testing.T) {
+	d := ParseDirective("// @inco: -nd db, cfg")
+	if d == nil {
+		t.Fatal("got nil")
+	}
+	want := "(!reflect.ValueOf(&db).Elem().IsZero()) && (!reflect.ValueOf(&cfg).Elem().IsZero())"
+	if d.Expr != want {
+		t.Errorf("Expr = %q, want %q", d.Expr, want)
+	}
+	if d.Each != nil {
+		t.Errorf("Each = %v, want nil without per-variable messages", d.Each)
+	}
+}
+
+func TestParseDirective_PerVarMessages(t *testing.T) {
+	d := ParseDirective(`// @inco: -nd db:"database handle required", cfg:"config missing", s, -return`)
+	if d == nil {
+		t.Fatal("got nil")
+	}
+	if len(d.Each) != 3 {
+		t.Fatalf("len(Each) = %d, want 3", len(d.Each))
+	}
+	wantDesc := []string{"database handle required", "config missing", "s must not be defaulted"}
+	for i, sub := range d.Each {
+		if sub.Desc != wantDesc[i] {
+			t.Errorf("Each[%d].Desc = %q, want %q", i, sub.Desc, wantDesc[i])
+		}
+		if sub.Action != ActionReturn {
+			t.Errorf("Each[%d].Action = %v, want ActionReturn", i, sub.Action)
+		}
+	}
+	if want := "!reflect.ValueOf(&db).Elem().IsZero()"; d.Each[0].Expr != want {
+		t.Errorf("Each[0].Expr = %q, want %q", d.Each[0].Expr, want)
+	}
+}
+
+func TestSplitVarMsg(t *testing.T) {
+	tests := []struct {
+		in, v, msg string
+		ok         bool
+	}{
+		{"db", "db", "", true},
+		{`db:"required"`, "db", "required", true},
+		{"s[1:2]", "s[1:2]", "", true},
+		{`m["a:b"]`, `m["a:b"]`, "", true},
+		{"db:oops", "", "", false},
+	}
+	for _, tt := range tests {
+		v, msg, ok := splitVarMsg(tt.in)
+		if v != tt.v || msg != tt.msg || ok != tt.ok {
+			t.Errorf("splitVarMsg(%q) = %q, %q, %v; want %q, %q, %v", tt.in, v, msg, ok, tt.v, tt.msg, tt.ok)
+		}
+	}
+}
+
+func TestEngine_NdPerVarMessages(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"main.go": `package main
+
+type Config struct{ Name string }
+
+func Open(db any, cfg Config) {
+	// @inco: -nd db:"database handle required", cfg:"config missing"
+	_ = db
+}
+`,
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	shadow := readShadow(t, e)
+	for _, want := range []string{
+		`panic("inco violation: database handle required (at main.go:6)")`,
+		`panic("inco violation: config missing (at main.go:6)")`,
+		`"reflect"`,
+	} {
+		if !strings.Contains(shadow, want) {
+			t.Errorf("missing %q in:\n%s", want, shadow)
+		}
+	}
+}
+
+// ---------------------------------------------------------------------------
+// -all / -any
+// ---------------------------------------------------------------------------
+
+func TestParseDirective_Quantifiers(t *testing.T) {
+	tests := []struct {
+		input, expr, desc string
+	}{
+		{
+			`// @inco: -all(it, it.ID != "") items`,
+			`func() bool { for _, it := range items { if !(it.ID != "") { return false } }; return true }()`,
+			`every element of items must satisfy it.ID != ""`,
+		},
+		{
+			`// @inco: -any(u, u.Admin) users`,
+			`func() bool { for _, u := range users { if u.Admin { return true } }; return false }()`,
+			`some element of users must satisfy u.Admin`,
+		},
+		{
+			`// @inco: -all(k, v, len(k) < v) m`,
+			`func() bool { for k, v := range m { if !(len(k) < v) { return false } }; return true }()`,
+			`every element of m must satisfy len(k) < v`,
+		},
+		{
+			`// @inco: all(items, func(it Item) bool { return it.ID != "" })`,
+			`func() bool { for _, incoElem := range items { if !(func(it Item) bool { return it.ID != "" }(incoElem)) { return false } }; return true }()`,
+			`every element of items must satisfy func(it Item) bool { return it.ID != "" }`,
+		},
+		{
+			`// @inco: any(m, func(k string, v int) bool { return len(k) < v }), -panic("none")`,
+			`func() bool { for incoKey, incoElem := range m { if func(k string, v int) bool { return len(k) < v }(incoKey, incoElem) { return true } }; return false }()`,
+			`some element of m must satisfy func(k string, v int) bool { return len(k) < v }`,
+		},
+		{
+			`// @inco: all(items, valid)`,
+			`all(items, valid)`,
+			``,
+		},
+	}
+	for _, tt := range tests {
+		d := ParseDirective(tt.input)
+		if d == nil {
+			t.Fatalf("ParseDirective(%q) = nil", tt.input)
+		}
+		if d.Expr != tt.expr || d.Desc != tt.desc {
+			t.Errorf("ParseDirective(%q):\n expr %s\n desc %s", tt.input, d.Expr, d.Desc)
+		}
+	}
+	for _, input := range []string{
+		`// @inco: -all(it.ID != "") items`,
+		`// @inco: -all(it, it.ID !=) items`,
+		`// @inco: -any(a.b, true) items`,
+	} {
+		if d := ParseDirective(input); d != nil {
+			t.Errorf("ParseDirective(%q) = %+v, want nil", input, d)
+		}
+	}
+}
+
+func TestEngine_Quantifiers(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"main.go": `package main
+
+type Item struct{ ID string }
+
+func Save(items []Item) {
+	// @inco: -all(it, it.ID != "") items
+	_ = items
+}
+
+func Load(items map[string]Item) {
+	// @inco: any(items, func(k string, it Item) bool { return k == it.ID })
+	_ = items
+}
+`,
+	})
+	e := NewEngine(dir)
+	e.Config.Typecheck = true
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	shadow := readShadow(t, e)
+	for _, want := range []string{
+		`if !(func() bool {`,
+		`every element of items must satisfy it.ID != \"\"`,
+		`some element of items must satisfy func(k string, it Item) bool { return k == it.ID }`,
+	} {
+		if !strings.Contains(shadow, want) {
+			t.Errorf("missing %q in:\n%s", want, shadow)
+		}
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "shadow.go", shadow, 0); err != nil {
+		t.Fatalf("shadow does not parse: %v\n%s", err, shadow)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// -idx
+// ---------------------------------------------------------------------------
+
+func TestParseDirective_Idx(t *testing.T) {
+	d := ParseDirective(`// @inco: -idx(i, items), -return(nil)`)
+	if d == nil {
+		t.Fatal("got nil")
+	}
+	if want := "i >= 0 && i < len(items)"; d.Expr != want {
+		t.Errorf("Expr = %q, want %q", d.Expr, want)
+	}
+	if want := "i must index items"; d.Desc != want {
+		t.Errorf("Desc = %q, want %q", d.Desc, want)
+	}
+	for _, input := range []string{
+		`// @inco: -idx(i) items`,
+		`// @inco: -idx(i, items) j`,
+		`// @inco: -idx(i, items, 2)`,
+		`// @inco: -idx`,
+	} {
+		if d := ParseDirective(input); d != nil {
+			t.Errorf("ParseDirective(%q) = %+v, want nil", input, d)
+		}
+	}
+}
+
+func TestEngine_IdxMessage(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"main.go": "package main\n\nfunc At(items []string, i int) string {\n\t// @inco: -idx(i, items)\n\treturn items[i]\n}\n",
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	shadow := readShadow(t, e)
+	want := `panic("inco violation: i must index items (at main.go:4)" + fmt.Sprintf(": index %d, len %d", i, len(items)))`
+	if !strings.Contains(shadow, want) || !strings.Contains(shadow, `"fmt"`) {
+		t.Errorf("missing %q in:\n%s", want, shadow)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// -pos / -nonneg
+// ---------------------------------------------------------------------------
+
+func TestParseDirective_Sign(t *testing.T) {
+	tests := []struct {
+		input, expr, desc string
+	}{
+		{`// @inco: -pos amount`, "amount > 0", "amount must be positive"},
+		{`// @inco: -pos amount, count`, "(amount > 0) && (count > 0)", "amount, count must be positive"},
+		{`// @inco: -nonneg offset, -return(ErrOffset)`, "offset >= 0", "offset must be non-negative"},
+	}
+	for _, tt := range tests {
+		d := ParseDirective(tt.input)
+		if d == nil {
+			t.Fatalf("ParseDirective(%q) = nil", tt.input)
+		}
+		if d.Expr != tt.expr || d.Desc != tt.desc {
+			t.Errorf("ParseDirective(%q):\n expr %s\n desc %s", tt.input, d.Expr, d.Desc)
+		}
+	}
+	for _, input := range []string{
+		`// @inco: -pos(1) amount`,
+		`// @inco: -nonneg`,
+	} {
+		if d := ParseDirective(input); d != nil {
+			t.Errorf("ParseDirective(%q) = %+v, want nil", input, d)
+		}
+	}
+
+	d := ParseDirective(`// @inco: -pos amount:"amount required", rate`)
+	if d == nil || len(d.Each) != 2 || d.Each[0].Desc != "amount required" || d.Each[1].Expr != "rate > 0" {
+		t.Errorf("per-variable -pos = %+v", d)
+	}
+}
@@ -4,7 +4,10 @@ package inco
 
 import (
 	"bufio"
+	"bytes"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 )
@@ -30,23 +33,34 @@ type ignorePattern struct {
 // LoadIgnore reads .incoignore from dir and returns the parsed list.
 // Returns nil if the file does not exist or contains no patterns.
 func LoadIgnore(dir string) *IgnoreList {
-	f, err := os.Open(filepath.Join(dir, ".incoignore"))
+	return loadIgnoreFS(os.DirFS(dir), ".")
+}
+
+// loadIgnoreFS is LoadIgnore for the directory dir of fsys.
+func loadIgnoreFS(fsys fs.FS, dir string) *IgnoreList {
+	data, err := fs.ReadFile(fsys, path.Join(dir, ".incoignore"))
 	_ = err // @inco: err == nil, -return(nil)
 	if !(err == nil) {
 		return nil
 	}
-//line /Users/hitomikirigiri/Desktop/imnive/inco/internal/inco/ignore.inco.go:33
-	defer f.Close()
 
-	var patterns []ignorePattern
-	scanner := bufio.NewScanner(f)
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
 	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-//line /Users/hitomikirigiri/Desktop/imnive/inco/internal/inco/ignore.inco.go:39
+		lines = append(lines, scanner.Text())
+	}
+	return NewIgnoreList(lines)
+}
+
+// NewIgnoreList parses patterns given as .incoignore lines. Returns nil
+// when there are no patterns.
+func NewIgnoreList(lines []string) *IgnoreList {
+	var patterns []ignorePattern
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
 		if !(line != "" && !strings.HasPrefix(line, "#")) {
 			continue
 		}
-//line /Users/hitomikirigiri/Desktop/imnive/inco/internal/inco/ignore.inco.go:40
 		dirOnly := strings.HasSuffix(line, "/")
 		if dirOnly {
 			line = strings.TrimSuffix(line, "/")
@@ -57,11 +71,9 @@ func LoadIgnore(dir string) *IgnoreList {
 			hasSlash: strings.Contains(line, "/"),
 		})
 	}
-//line /Users/hitomikirigiri/Desktop/imnive/inco/internal/inco/ignore.inco.go:50
 	if !(len(patterns) > 0) {
 		return nil
 	}
-//line /Users/hitomikirigiri/Desktop/imnive/inco/internal/inco/ignore.inco.go:51
 	return &IgnoreList{patterns: patterns}
 }
 
@@ -112,6 +124,7 @@ func (ig *IgnoreList) Match(relPath string, isDir bool) bool {
 // adds rules that apply only within that subtree.
 type IgnoreTree struct {
 	root   string
+	fsys   fs.FS         // the tree under root, from which .incoignore files are read
 	layers []ignoreLayer // stack: layers[0] = root, layers[n] = deepest dir
 }
 
@@ -122,10 +135,16 @@ type ignoreLayer struct {
 
 // NewIgnoreTree creates a tree rooted at root and loads the root .incoignore.
 func NewIgnoreTree(root string) *IgnoreTree {
+	return newIgnoreTreeFS(root, os.DirFS(root))
+}
+
+// newIgnoreTreeFS is NewIgnoreTree reading the tree under root from fsys.
+func newIgnoreTreeFS(root string, fsys fs.FS) *IgnoreTree {
 	return &IgnoreTree{
 		root: root,
+		fsys: fsys,
 		layers: []ignoreLayer{
-			{dir: root, ig: LoadIgnore(root)},
+			{dir: root, ig: loadIgnoreFS(fsys, ".")},
 		},
 	}
 }
@@ -133,10 +152,11 @@ func NewIgnoreTree(root string) *IgnoreTree {
 // EnterDir pushes a directory onto the stack. It loads .incoignore from dir
 // if present. Must be called when the walker enters a directory.
 func (t *IgnoreTree) EnterDir(dir string) {
-	t.layers = append(t.layers, ignoreLayer{
-		dir: dir,
-		ig:  LoadIgnore(dir),
-	})
+	var ig *IgnoreList
+	if rel, err := filepath.Rel(t.root, dir); err == nil && filepath.IsLocal(rel) {
+		ig = loadIgnoreFS(t.fsys, filepath.ToSlash(rel))
+	}
+	t.layers = append(t.layers, ignoreLayer{dir: dir, ig: ig})
 }
 
 // LeaveDir pops directories from the stack until the current top no longer
@@ -0,0 +1,53 @@
+package inco
+
+import (
+	"go/build"
+	"go/token"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestExportImporter(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go toolchain not available")
+	}
+	dir := setupDir(t, map[string]string{
+		"go.mod":         "module example.com/m\n\ngo 1.22\n",
+		"a/a.go":         "package a\n\nimport \"fmt\"\n\nfunc Hello() string { return fmt.Sprint(\"hi\") }\n",
+		"a/a_other.go":   "//go:build !windows\n\npackage a\n\nconst OS = \"other\"\n",
+		"a/a_windows.go": "package a\n\nconst OS = \"windows\"\n",
+	})
+	imp := newExportImporter(&build.Default, dir, token.NewFileSet())
+	if err := imp.Preload([]string{"example.com/m/a"}); err != nil {
+		t.Fatal(err)
+	}
+	pkg, err := imp.Import("example.com/m/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Positions name the sources, for the contracts of the callee.
+	if pos := imp.fset.Position(pkg.Scope().Lookup("Hello").Pos()); pos.Filename != filepath.Join(dir, "a", "a.go") || pos.Line != 5 {
+		t.Errorf("Hello at %v, want a/a.go:5", pos)
+	}
+	if !imp.loaded(filepath.Join(dir, "a")) {
+		t.Error("directory of a not recorded as loaded")
+	}
+	if _, err := imp.Import("example.com/m/missing"); err == nil {
+		t.Error("importing a missing package should fail")
+	}
+
+	ctxt := build.Default
+	ctxt.GOOS, ctxt.GOARCH, ctxt.CgoEnabled = "windows", "amd64", false
+	imp = newExportImporter(&ctxt, dir, token.NewFileSet())
+	pkg, err = imp.Import("example.com/m/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := pkg.Scope().Lookup("OS").String(); got != `const example.com/m/a.OS untyped string` {
+		t.Errorf("OS = %s", got)
+	}
+	if pos := imp.fset.Position(pkg.Scope().Lookup("OS").Pos()); filepath.Base(pos.Filename) != "a_windows.go" {
+		t.Errorf("OS declared at %v, want a_windows.go for windows", pos)
+	}
+}
@@ -0,0 +1,140 @@
+package inco
+
+import (
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEngine_LinePositions(t *testing.T) {
+	// One-line blocks that gofmt would reflow, lines that repeat, and
+	// guards that need an import.
+	src := `package main
+
+func F(n int, xs []int) error {
+	if x := n; x > 0 { return nil }
+	// @inco: n > 0, -return(fmt.Errorf("bad %d", n))
+	for _, x := range xs { // @inco: x != 0, -continue
+		_ = x
+	}
+	// @inco: n < 10, -return(fmt.Errorf("big %d", n))
+	if x := n; x > 0 { return nil }
+	return nil
+}
+`
+	dir := setupDir(t, map[string]string{"main.go": src})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	shadow := readShadow(t, e)
+	if !strings.Contains(shadow, "import (\n\t\"fmt\"\n)") {
+		t.Errorf("import not added:\n%s", shadow)
+	}
+	if strings.Count(shadow, "\tif x := n; x > 0 {\n\t\treturn nil\n\t}\n") != 2 {
+		t.Errorf("shadow not gofmt'd:\n%s", shadow)
+	}
+
+	path := filepath.Join(dir, "main.go")
+	pos := e.shadowPositions(path, []byte(shadow))
+	if pos == nil {
+		t.Fatal("no positions for the shadow")
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, path, shadow, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tf := fset.File(f.Pos())
+	srcLines := strings.Split(src, "\n")
+	shadowLines := strings.Split(shadow, "\n")
+	if len(pos) != len(shadowLines) {
+		t.Fatalf("%d positions for %d lines", len(pos), len(shadowLines))
+	}
+	for i, text := range shadowLines {
+		p := pos[i]
+		switch {
+		case p.line == 0 || p.injected || i+1 > tf.LineCount():
+		case i > 0 && pos[i-1] == p:
+			// A line gofmt split off the one before.
+		case !strings.HasPrefix(strings.TrimSpace(srcLines[p.line-1]), strings.TrimSpace(text)):
+			t.Errorf("shadow line %d %q recorded as source line %d %q", i+1, text, p.line, srcLines[p.line-1])
+		case tf.PositionFor(tf.LineStart(i+1), true).Line != p.line:
+			t.Errorf("shadow line %d %q compiles as line %d, want %d", i+1, text, tf.PositionFor(tf.LineStart(i+1), true).Line, p.line)
+		}
+	}
+	for want, marker := range map[int]string{5: `"bad %d"`, 6: "continue", 9: `"big %d"`} {
+		for i, text := range shadowLines {
+			if strings.Contains(text, marker) {
+				if got := blameShadow(tf, pos, i+1); got != want {
+					t.Errorf("%s blamed on line %d, want %d", marker, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestEngine_CRLF(t *testing.T) {
+	// Generated code, a hoisted init and a raw string spanning lines,
+	// in a source with Windows line endings.
+	src := `package main
+
+func F(n int, s string) error {
+	// @inco: n > 0, -return(fmt.Errorf("bad %d", n))
+	if x := n; x > 0 { // @inco: x < 10, -return(nil)
+		return nil
+	}
+	_ = ` + "`a\nb`" + `
+	// @inco: s != "", -return(fmt.Errorf("empty"))
+	return nil
+}
+`
+	crlf := strings.ReplaceAll(src, "\n", "\r\n")
+	dir := setupDir(t, map[string]string{"main.go": crlf})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	shadow := readShadow(t, e)
+	if strings.Count(shadow, "\n") != strings.Count(shadow, "\r\n") {
+		t.Errorf("shadow mixes line endings:\n%q", shadow)
+	}
+
+	path := filepath.Join(dir, "main.go")
+	pos := e.shadowPositions(path, []byte(shadow))
+	if pos == nil {
+		t.Fatal("no positions for the shadow")
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, path, shadow, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tf := fset.File(f.Pos())
+	for want, marker := range map[int]string{4: `"bad %d"`, 5: "x < 10", 10: `"empty"`} {
+		for i, text := range strings.Split(shadow, "\n") {
+			if strings.Contains(text, marker) {
+				if got := blameShadow(tf, pos, i+1); got != want {
+					t.Errorf("%s blamed on line %d, want %d", marker, got, want)
+				}
+				if got := tf.PositionFor(tf.LineStart(i+1), true).Line; got != want && pos[i].line == want && !pos[i].injected {
+					t.Errorf("%s compiles as line %d, want %d", marker, got, want)
+				}
+			}
+		}
+	}
+
+	// The same source with Unix line endings generates the same shadow.
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if lf := readShadow(t, e); strings.ReplaceAll(shadow, "\r\n", "\n") != lf {
+		t.Errorf("CRLF shadow:\n%s\nwant, as for LF:\n%s", shadow, lf)
+	}
+}
@@ -0,0 +1,40 @@
+package inco
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpandMacros(t *testing.T) {
+	macros := map[string]string{
+		"nonEmptyID": "len(%s) > 0 && len(%v) < 64",
+		"between":    "%[1]s >= %[2]s && %[1]s <= %[3]s",
+		"port":       "@between(%s, 1, 65535)",
+		"loop":       "@loop(%s)",
+	}
+	tests := []struct {
+		in, want, err string
+	}{
+		{"// @inco: @nonEmptyID(id)", "// @inco: (len(id) > 0 && len(id) < 64)", ""},
+		{"// @inco: @between(n, 0, f(a, b)), -return(0)", "// @inco: (n >= 0 && n <= f(a, b)), -return(0)", ""},
+		{"// @inco: @port(p)", "// @inco: ((p >= 1 && p <= 65535))", ""},
+		{`// @inco: ok, -panic("@nonEmptyID(x)")`, `// @inco: ok, -panic("@nonEmptyID(x)")`, ""},
+		{"// @inco[nightly]: x > 0", "// @inco[nightly]: x > 0", ""},
+		{"// @inco: @between(n, 0)", "", "takes 3 argument(s), got 2"},
+		{"// @inco: @missing(x)", "", "unknown macro @missing"},
+		{"// @inco: @nonEmptyID(id", "", "unbalanced"},
+		{"// @inco: @loop(x)", "", "recursive"},
+	}
+	for _, tt := range tests {
+		got, err := expandMacros(tt.in, macros)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("expandMacros(%q) error = %v, want %q", tt.in, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("expandMacros(%q) = %q, %v; want %q", tt.in, got, err, tt.want)
+		}
+	}
+}
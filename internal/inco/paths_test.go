@@ -0,0 +1,110 @@
+package inco
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNativePathFor(t *testing.T) {
+	for _, tc := range []struct {
+		goos, path, native, line string
+	}{
+		{"windows", `c:\src\a.go`, `C:\src\a.go`, "C:/src/a.go"},
+		{"windows", "c:/src/a.go", `C:\src\a.go`, "C:/src/a.go"},
+		{"windows", `D:\src/pkg\a.go`, `D:\src\pkg\a.go`, "D:/src/pkg/a.go"},
+		{"windows", `\\host\share\a.go`, `\\host\share\a.go`, "//host/share/a.go"},
+		{"linux", `/src/a\b.go`, `/src/a\b.go`, `/src/a\b.go`},
+		{"darwin", "/src/a.go", "/src/a.go", "/src/a.go"},
+	} {
+		if got := nativePathFor(tc.goos, tc.path); got != tc.native {
+			t.Errorf("nativePathFor(%s, %q) = %q, want %q", tc.goos, tc.path, got, tc.native)
+		}
+		if got := linePathFor(tc.goos, tc.path); got != tc.line {
+			t.Errorf("linePathFor(%s, %q) = %q, want %q", tc.goos, tc.path, got, tc.line)
+		}
+	}
+}
+
+func TestEngine_TrimPath(t *testing.T) {
+	files := map[string]string{
+		"go.mod": "module example.com/m\n\ngo 1.22\n",
+		"a/p/p.go": `package p
+
+func Half(n int) int {
+	// @inco: n%2 == 0
+	m := n / 2
+	return m + undefined
+}
+`,
+	}
+	var shadows []string
+	for range 2 {
+		dir := setupDir(t, files)
+		e := NewEngine(dir)
+		e.Config.TrimPath = true
+		e.Config.Typecheck = true
+		if err := e.Run(); err != nil {
+			t.Fatalf("Run reported the source's own type error as generated code: %v", err)
+		}
+		shadow := readShadow(t, e)
+		for _, want := range []string{"//line ../a/p/p.go:5\n", `"inco violation: n%2 == 0 (at a/p/p.go:4)"`} {
+			if !strings.Contains(shadow, want) {
+				t.Errorf("shadow does not contain %q:\n%s", want, shadow)
+			}
+		}
+		shadows = append(shadows, shadow)
+
+		out := t.TempDir()
+		if err := e.Export(out); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(filepath.Join(out, "a", "p", "p.go"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), "//line p.go:5\n") {
+			t.Errorf("exported shadow should name the file next to it:\n%s", data)
+		}
+	}
+	if shadows[0] != shadows[1] {
+		t.Errorf("shadows of two checkouts differ:\n%s\n---\n%s", shadows[0], shadows[1])
+	}
+}
+
+func TestEngine_TrimPathWithoutDirectives(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		".inco.json": `{"trim_path": true}`,
+		"go.mod":     "module example.com/tp\n\ngo 1.22\n",
+		"main.go": `package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func main() {
+	_, file, line, _ := runtime.Caller(0)
+	fmt.Printf("%s:%d", file, line)
+}
+`,
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if shadow := readShadow(t, e); !strings.HasPrefix(shadow, "//line ../main.go:1\n") {
+		t.Fatalf("shadow does not start by naming its source:\n%s", shadow)
+	}
+	cmd := exec.Command("go", "run", "-trimpath", "-overlay", e.OverlayPath(), ".")
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("go run: %v\n%s", err, out)
+	}
+	if want := "example.com/tp/main.go:9"; string(out) != want {
+		t.Errorf("caller = %q, want %q", out, want)
+	}
+}
@@ -0,0 +1,149 @@
+package inco
+
+import (
+	"go/parser"
+	"go/token"
+	"testing"
+)
+
+// ---------------------------------------------------------------------------
+// parsePragma
+// ---------------------------------------------------------------------------
+
+func TestParsePragma(t *testing.T) {
+	tests := []struct {
+		comment    string
+		name, args string
+		ok         bool
+	}{
+		{"//inco:disable", "disable", "", true},
+		{"//inco:enable  ", "enable", "", true},
+		{"//inco:default -return", "default", "-return", true},
+		{"// inco:disable", "", "", false},
+		{"// @inco: x > 0", "", "", false},
+		{"/* inco:disable */", "", "", false},
+	}
+	for _, tt := range tests {
+		name, args, ok := parsePragma(tt.comment)
+		if name != tt.name || args != tt.args || ok != tt.ok {
+			t.Errorf("parsePragma(%q) = %q, %q, %v; want %q, %q, %v",
+				tt.comment, name, args, ok, tt.name, tt.args, tt.ok)
+		}
+	}
+}
+
+// ---------------------------------------------------------------------------
+// collectPragmas — disabled regions
+// ---------------------------------------------------------------------------
+
+func TestCollectPragmas_Disabled(t *testing.T) {
+	src := `package p
+
+func F(x int) {
+	//inco:disable
+	// @inco: x > 0
+	//inco:enable
+	// @inco: x < 10
+	//inco:disable
+	// @inco: x != 5
+}
+`
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "p.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := collectPragmas(f, fset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for line, want := range map[int]bool{3: true, 4: false, 5: false, 6: false, 7: true, 9: false, 10: false} {
+		if got := p.enabled(line); got != want {
+			t.Errorf("enabled(%d) = %v, want %v", line, got, want)
+		}
+	}
+}
+
+// ---------------------------------------------------------------------------
+// collectPragmas — skipped functions
+// ---------------------------------------------------------------------------
+
+func TestCollectPragmas_Skip(t *testing.T) {
+	src := `package p
+
+// F is hand-tuned.
+//
+//inco:skip
+func F(x int) {
+	// @inco: x > 0
+}
+
+func G(x int) {
+	// @inco: x > 0
+}
+`
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "p.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := collectPragmas(f, fset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for line, want := range map[int]bool{6: false, 7: false, 8: false, 10: true, 11: true} {
+		if got := p.enabled(line); got != want {
+			t.Errorf("enabled(%d) = %v, want %v", line, got, want)
+		}
+	}
+}
+
+// ---------------------------------------------------------------------------
+// collectPragmas — default action
+// ---------------------------------------------------------------------------
+
+func TestCollectPragmas_Default(t *testing.T) {
+	tests := []struct {
+		pragmas string
+		want    string
+		wantErr bool
+	}{
+		{"//inco:default -return(ErrInvalid)", "-return(ErrInvalid)", false},
+		{"//inco:default -log, -logonce", "-log, -logonce", false},
+		{"//inco:default -logonce", "", true},
+		{"//inco:default -msgf(\"x\")", "", true},
+		{"//inco:default", "", true},
+		{"//inco:default -log\n//inco:default -warn", "", true},
+	}
+	for _, tt := range tests {
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, "p.go", tt.pragmas+"\npackage p\n", parser.ParseComments)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, err := collectPragmas(f, fset)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: err = %v, wantErr %v", tt.pragmas, err, tt.wantErr)
+			continue
+		}
+		if err == nil && p.defaultAction != tt.want {
+			t.Errorf("%q: defaultAction = %q, want %q", tt.pragmas, p.defaultAction, tt.want)
+		}
+	}
+}
+
+func TestFilePragmas_Parse(t *testing.T) {
+	p := filePragmas{defaultAction: "-return(ErrInvalid)"}
+	d := p.parse("// @inco: x > 0")
+	if d == nil || d.Action != ActionReturn || len(d.ActionArgs) != 1 || d.ActionArgs[0] != "ErrInvalid" {
+		t.Fatalf("default not applied: %+v", d)
+	}
+	d = p.parse("// @inco: x > 0, -panic(\"boom\")")
+	if d == nil || d.Action != ActionPanic {
+		t.Fatalf("explicit action should override the default: %+v", d)
+	}
+	d = p.parse("// @inco: -nd a:\"a required\", b")
+	if d == nil || len(d.Each) != 2 || d.Each[0].Action != ActionReturn {
+		t.Fatalf("default not applied to per-variable checks: %+v", d)
+	}
+}
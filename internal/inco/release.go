@@ -5,6 +5,7 @@ package inco
 import (
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
@@ -22,11 +23,13 @@ const releaseHeader = "// Code generated by inco. DO NOT EDIT.\n\n"
 //   - The original .inco.go is renamed to .inco (backup — invisible to the
 //     Go compiler).
 //
-// If dryRun is true, no files are modified — only a preview is printed.
+// If dryRun is true, no files are modified — only a preview is logged.
+// Each released file is logged at Info level to logger, which may be nil.
 //
 // After release, plain "go build" compiles the guarded .go files.
 // "inco release clean" restores the originals.
-func Release(root string, dryRun bool) error {
+func Release(root string, dryRun bool, logger *slog.Logger) error {
+	log := orDiscard(logger)
 //line /Users/hitomikirigiri/Desktop/imnive/inco/internal/inco/release.inco.go:28
 	if !(root != "") {
 		return fmt.Errorf("Release: root must not be empty")
@@ -56,7 +59,7 @@ func Release(root string, dryRun bool) error {
 		rel, _ := filepath.Rel(root, releasePath)
 
 		if dryRun {
-			fmt.Fprintf(os.Stderr, "  [dry-run] %s\n", rel)
+			log.Info("would release", "file", rel)
 			released++
 			continue
 		}
@@ -69,8 +72,15 @@ func Release(root string, dryRun bool) error {
 		}
 //line /Users/hitomikirigiri/Desktop/imnive/inco/internal/inco/release.inco.go:50
 
-		// 2. Write <base>.go alongside the original.
-		err = os.WriteFile(releasePath, []byte(releaseHeader+string(shadowContent)), 0o644)
+		// 2. Write <base>.go alongside the original, in its line endings.
+		// Relative //line names (trim_path) resolve against the shadow's
+		// directory; the released file is next to the source.
+		shadowContent = renameLines(shadowContent, cacheLinePath(root, origPath), filepath.Base(origPath))
+		header := releaseHeader
+		if usesCRLF(shadowContent) {
+			header = strings.ReplaceAll(header, "\n", "\r\n")
+		}
+		err = os.WriteFile(releasePath, []byte(header+string(shadowContent)), 0o644)
 		_ = err // @inco: err == nil, -return(fmt.Errorf("Release: write %s: %w", releasePath, err))
 		if !(err == nil) {
 			return fmt.Errorf("Release: write %s: %w", releasePath, err)
@@ -86,14 +96,10 @@ func Release(root string, dryRun bool) error {
 		}
 //line /Users/hitomikirigiri/Desktop/imnive/inco/internal/inco/release.inco.go:59
 
-		fmt.Fprintf(os.Stderr, "  %s\n", rel)
+		log.Info("released", "file", rel)
 		released++
 	}
-	prefix := "inco:"
-	if dryRun {
-		prefix = "inco: [dry-run]"
-	}
-	fmt.Fprintf(os.Stderr, "%s released %d file(s)\n", prefix, released)
+	log.Info("release complete", "files", released, "dry_run", dryRun)
 	return nil
 }
 
@@ -102,7 +108,11 @@ func Release(root string, dryRun bool) error {
 // For each overlay entry whose original is a .inco.go file:
 //   - The generated .go file is removed.
 //   - The .inco backup is renamed back to .inco.go.
-func ReleaseClean(root string) error {
+//
+// Each removed and restored file is logged at Info level to logger, which
+// may be nil.
+func ReleaseClean(root string, logger *slog.Logger) error {
+	log := orDiscard(logger)
 //line /Users/hitomikirigiri/Desktop/imnive/inco/internal/inco/release.inco.go:77
 	if !(root != "") {
 		return fmt.Errorf("ReleaseClean: root must not be empty")
@@ -134,17 +144,17 @@ func ReleaseClean(root string) error {
 		// Remove generated .go file.
 		if err := os.Remove(releasePath); err == nil {
 			rel, _ := filepath.Rel(root, releasePath)
-			fmt.Fprintf(os.Stderr, "  removed %s\n", rel)
+			log.Info("removed", "file", rel)
 		}
 
 		// Restore .inco → .inco.go.
 		if err := os.Rename(backupPath, origPath); err == nil {
 			rel, _ := filepath.Rel(root, origPath)
-			fmt.Fprintf(os.Stderr, "  restored %s\n", rel)
+			log.Info("restored", "file", rel)
 			cleaned++
 		}
 	}
-	fmt.Fprintf(os.Stderr, "inco: restored %d file(s)\n", cleaned)
+	log.Info("release clean complete", "files", cleaned)
 	return nil
 }
 
@@ -152,7 +162,8 @@ func ReleaseClean(root string) error {
 // Helpers
 // ---------------------------------------------------------------------------
 
-// loadOverlay reads and parses .inco_cache/overlay.json.
+// loadOverlay reads and parses .inco_cache/overlay.json, resolving paths
+// relative to the configured overlay base.
 func loadOverlay(root string) (Overlay, error) {
 	overlayPath := filepath.Join(root, ".inco_cache", "overlay.json")
 	data, err := os.ReadFile(overlayPath)
@@ -169,7 +180,12 @@ func loadOverlay(root string) (Overlay, error) {
 		return Overlay{}, fmt.Errorf("loadOverlay: unmarshal: %w", err)
 	}
 //line /Users/hitomikirigiri/Desktop/imnive/inco/internal/inco/release.inco.go:120
-	return ov, nil
+	cfg, err := LoadConfig(root)
+	_ = err // @inco: err == nil, -return(Overlay{}, fmt.Errorf("loadOverlay: %w", err))
+	if !(err == nil) {
+		return Overlay{}, fmt.Errorf("loadOverlay: %w", err)
+	}
+	return absOverlay(ov, cfg.overlayBase(root)), nil
 }
 
 // releasePathFor returns the .go path for a .inco.go source file.
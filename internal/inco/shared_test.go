@@ -0,0 +1,130 @@
+package inco
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestEngine_SharedCache(t *testing.T) {
+	files := map[string]string{
+		"a/a.go": "package a\n\nfunc A(p *int) {\n\t// @inco: p != nil\n}\n",
+		"b/b.go": "package b\n\nfunc B(n int) {\n\t// @inco: n > 0\n\t// @inco oops\n}\n",
+	}
+	var mu sync.Mutex
+	store := make(map[string][]byte)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		key := strings.TrimPrefix(r.URL.Path, "/")
+		switch r.Method {
+		case http.MethodGet:
+			data, ok := store[key]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write(data)
+		case http.MethodPut:
+			store[key], _ = io.ReadAll(r.Body)
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	defer srv.Close()
+
+	for _, spec := range []string{t.TempDir(), srv.URL} {
+		dir := setupDir(t, files)
+		cache, err := OpenSharedCache(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e := NewEngine(dir)
+		e.SharedCache = cache
+		report, err := e.RunReport(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.Processed != 2 || report.Shared != 0 {
+			t.Fatalf("%s: first run processed %d, shared %d; want 2 generated", spec, report.Processed, report.Shared)
+		}
+		aPath := filepath.Join(dir, "a", "a.go")
+		want, err := os.ReadFile(e.Overlay.Replace[aPath])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// A fresh checkout at the same path fetches both shadows.
+		if err := os.RemoveAll(filepath.Join(dir, ".inco_cache")); err != nil {
+			t.Fatal(err)
+		}
+		e = NewEngine(dir)
+		e.SharedCache = cache
+		report, err = e.RunReport(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.Processed != 2 || report.Shared != 2 || report.FilesWithDirectives != 2 || len(report.Warnings) != 1 {
+			t.Errorf("%s: second run = %+v, want both shadows and the warning from the shared cache", spec, report)
+		}
+		if got, _ := os.ReadFile(e.Overlay.Replace[aPath]); !bytes.Equal(got, want) {
+			t.Errorf("%s: shared shadow differs:\n%s\nwant:\n%s", spec, got, want)
+		}
+
+		// Another configuration does not reuse the entries.
+		if err := os.RemoveAll(filepath.Join(dir, ".inco_cache")); err != nil {
+			t.Fatal(err)
+		}
+		e = NewEngine(dir)
+		e.SharedCache = cache
+		e.Config.StackTrace = true
+		if report, err = e.RunReport(context.Background()); err != nil || report.Shared != 0 {
+			t.Errorf("%s: run with another config: shared %d, err %v; want no hits", spec, report.Shared, err)
+		}
+	}
+}
+
+func TestEngine_SharedCacheErrors(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"a/a.go": "package a\n\nfunc A(p *int) {\n\t// @inco: p != nil\n}\n",
+	})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	var log bytes.Buffer
+	e := NewEngine(dir)
+	e.SharedCache = &HTTPCache{URL: srv.URL}
+	e.Logger = slog.New(slog.NewTextHandler(&log, nil))
+	report, err := e.RunReport(context.Background())
+	if err != nil {
+		t.Fatalf("an unavailable shared cache must not fail the run: %v", err)
+	}
+	if report.Processed != 1 || report.Shared != 0 {
+		t.Errorf("report = %+v, want the file generated", report)
+	}
+	if !strings.Contains(log.String(), "503") {
+		t.Errorf("log = %q, want the cache errors", log.String())
+	}
+}
+
+func TestGeneratorVersion(t *testing.T) {
+	// A test binary is built without a module version or VCS stamp: it is
+	// identified by its executable.
+	v := generatorVersion()
+	if !strings.HasPrefix(v, "exe ") || len(v) != len("exe ")+64 {
+		t.Errorf("generatorVersion() = %q, want the hash of the test binary", v)
+	}
+	e := NewEngine(t.TempDir())
+	prefix, ok := e.sharedKeyPrefix("cfg")
+	if !ok || !strings.Contains(prefix, v) {
+		t.Errorf("sharedKeyPrefix = %q, %v; want it to contain %q", prefix, ok, v)
+	}
+}
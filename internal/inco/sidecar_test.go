@@ -0,0 +1,88 @@
+package inco
+
+import (
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadContracts(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		".inco.json":           `{"contracts": {"./gen": {"Parse": ["len(src) > 0"]}}}`,
+		".inco.contracts.json": `{"gen/": {"Parse": ["src != nil"], "Client.Do": ["req != nil"]}, ".": {"main": ["true"]}}`,
+	})
+	cfg, err := LoadConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]map[string][]string{
+		"gen": {"Parse": {"len(src) > 0", "src != nil"}, "Client.Do": {"req != nil"}},
+		".":   {"main": {"true"}},
+	}
+	if !reflect.DeepEqual(cfg.Contracts, want) {
+		t.Errorf("Contracts = %v, want %v", cfg.Contracts, want)
+	}
+
+	dir = setupDir(t, map[string]string{".inco.contracts.json": `{"gen": ["x"]}`})
+	if _, err := LoadConfig(dir); err == nil || !strings.Contains(err.Error(), contractsFile) {
+		t.Errorf("expected %s error, got %v", contractsFile, err)
+	}
+}
+
+func TestEngine_Sidecar(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		".inco.contracts.json": `{
+  "gen": {
+    "Parse":     ["len(src) > 0, -return(nil)", "cap(src) < 1024"],
+    "Client.Do": ["req != \"\""]
+  }
+}`,
+		"gen/gen.go": `// Code generated by protoc. DO NOT EDIT.
+
+package gen
+
+type Client struct{}
+
+func (c *Client) Do(req string) {
+	// @inco: c != nil
+}
+
+func Parse(src []byte) []byte {
+	return src
+}
+
+func Other(src []byte) {
+}
+`,
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	shadow := readShadow(t, e)
+	path := filepath.Join(dir, "gen", "gen.go")
+	for _, want := range []string{
+		"func (c *Client) Do(req string) {\n//line " + path + ":7\n\tif !(req != \"\") {",
+		"func Parse(src []byte) []byte {\n//line " + path + ":11\n\tif !(len(src) > 0) {\n\t\treturn nil\n\t}\n//line " + path + ":11\n\tif !(cap(src) < 1024) {",
+		"inco violation: cap(src) < 1024 (at gen/gen.go:11)",
+		"func Other(src []byte) {\n}",
+	} {
+		if !strings.Contains(shadow, want) {
+			t.Errorf("missing %q in:\n%s", want, shadow)
+		}
+	}
+	if strings.Index(shadow, `req != ""`) > strings.Index(shadow, "c != nil") {
+		t.Errorf("sidecar contracts should precede in-source directives:\n%s", shadow)
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "shadow.go", shadow, 0); err != nil {
+		t.Fatalf("shadow does not parse: %v\n%s", err, shadow)
+	}
+
+	writeFile(t, filepath.Join(dir, ".inco.contracts.json"), `{"gen": {"Parse": ["-len() src"]}}`)
+	if err := NewEngine(dir).Run(); err == nil || !strings.Contains(err.Error(), `Parse: sidecar contract: invalid contract "-len() src"`) {
+		t.Errorf("expected invalid contract error, got %v", err)
+	}
+}
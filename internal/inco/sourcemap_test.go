@@ -0,0 +1,65 @@
+package inco
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEngine_SourceMap(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"p/p.go": `package p
+
+func Half(n int) int {
+	// @inco: n%2 == 0, -return(-1)
+	m := n / 2
+	return m
+}
+`,
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(dir, "p", "p.go")
+	shadow := e.Overlay.Replace[src]
+	m, err := ReadSourceMap(shadow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(shadow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(data), "\n")
+	if m.Shadow != shadow || m.Source != src || len(m.Lines) != len(lines) {
+		t.Fatalf("source map = %+v, want %d lines of %s for %s", m, len(lines), shadow, src)
+	}
+	for want, text := range map[[2]int]string{{4, 1}: "return -1", {5, 0}: "m := n / 2", {6, 0}: "return m"} {
+		for i, l := range lines {
+			if strings.TrimSpace(l) != text {
+				continue
+			}
+			if line, injected := m.SourceLine(i + 1); line != want[0] || injected != (want[1] == 1) {
+				t.Errorf("SourceLine(%d) for %q = %d, %v; want %d, %v", i+1, text, line, injected, want[0], want[1] == 1)
+			}
+		}
+	}
+
+	// The map stays authoritative after the source changes, until the
+	// next Run replaces the shadow and removes the map with it.
+	writeFile(t, src, "package p\n\n// Half halves n.\nfunc Half(n int) int {\n\treturn n / 2\n}\n")
+	if pos := e.shadowLines(src, shadow, data); len(pos) != len(lines) {
+		t.Errorf("shadowLines with a changed source = %v, want the map's %d lines", pos, len(lines))
+	}
+	if pos := e.shadowLines(src, shadow, append(data, '\n')); pos != nil {
+		t.Errorf("shadowLines of another shadow = %v, want nil: the map is stale and the source no longer generates it", pos)
+	}
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(sourceMapPath(shadow)); !os.IsNotExist(err) {
+		t.Errorf("source map of a removed shadow survived: %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+package inco
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSuggest(t *testing.T) {
+	options := strings.Split(optionNames, "|")
+	for _, tc := range []struct {
+		name       string
+		candidates []string
+		want       string
+	}{
+		{"nb", []string{"idx", "is", "nd", "nonneg"}, "nd"},
+		{"ret", options, "return"},
+		{"retrun", options, "return"},
+		{"pnaic", options, "panic"},
+		{"inoc", []string{"inco"}, "inco"},
+		{"disabel", pragmaNames, "disable"},
+		{"xyz", options, ""},
+		{"r", options, ""},
+		{"param", strings.Split(annotationNames, "|"), ""},
+	} {
+		if got := suggest(tc.name, tc.candidates); got != tc.want {
+			t.Errorf("suggest(%q) = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestEngine_TypoSuggestions(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"main.go": `package main
+
+//inco:disabel
+
+// @tarce
+func F(x *int) error {
+	// @inco: -nb x
+	// @inco: x != nil, -ret(nil)
+	// @inoc: x != nil
+	// @see: the docs
+	// @param x
+	return nil
+}
+`,
+	})
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	want := map[int]string{
+		3: "unknown pragma //inco:disabel ignored, did you mean //inco:disable?",
+		5: "unknown annotation @tarce ignored, did you mean @trace?",
+		7: "malformed directive ignored: @inco: -nb x (unknown flag -nb, did you mean -nd?)",
+		8: "unknown option -ret, did you mean -return?",
+		9: "unknown keyword @inoc ignored, did you mean @inco?",
+	}
+	got := e.Diagnostics()
+	for _, d := range got {
+		if want[d.Line] != d.Message {
+			t.Errorf("line %d: %q, want %q", d.Line, d.Message, want[d.Line])
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("got %d warnings, want %d: %v", len(got), len(want), got)
+	}
+}
@@ -0,0 +1,154 @@
+package inco
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseDirective_DSL(t *testing.T) {
+	d := ParseDirective("// @inco: -dsl(cel) size(name) > 0, amount in [1, 2], -return(ErrBad)")
+	if d == nil {
+		t.Fatal("got nil")
+	}
+	if d.Flag != "dsl" || d.FlagArgs[0] != "cel" {
+		t.Errorf("Flag = %q, FlagArgs = %v", d.Flag, d.FlagArgs)
+	}
+	if want := "size(name) > 0, amount in [1, 2]"; d.Expr != want {
+		t.Errorf("Expr = %q, want %q", d.Expr, want)
+	}
+	if d.Action != ActionReturn {
+		t.Errorf("Action = %v, want ActionReturn", d.Action)
+	}
+	if ParseDirective("// @inco: -dsl(no lang) x") != nil {
+		t.Error("malformed language should be rejected")
+	}
+}
+
+func TestEngine_DSLTranslator(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"main.go": `package main
+
+func Pay(amount int) {
+	// @inco: -dsl(rule) amount positive
+	_ = amount
+}
+`,
+	})
+	e := NewEngine(dir)
+	e.Translators = map[string]Translator{
+		"rule": func(src string) (string, error) {
+			return strings.Replace(src, " positive", " > 0", 1), nil
+		},
+	}
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	shadow := readShadow(t, e)
+	if !strings.Contains(shadow, "if !(amount > 0) {") {
+		t.Errorf("condition should be translated, got:\n%s", shadow)
+	}
+	if !strings.Contains(shadow, `"inco violation: amount positive (at main.go:4)"`) {
+		t.Errorf("message should quote the DSL source, got:\n%s", shadow)
+	}
+}
+
+func TestEngine_DSLCommandTranslator(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		".inco.json": `{"translators": {"words": ["sh", "-c", "sed 's/ and / \\&\\& /g'"]}}`,
+		"main.go": `package main
+
+func F(a, b bool) {
+	// @inco: -dsl(words) a and b
+	_ = a
+}
+`,
+	})
+	e := NewEngine(dir)
+	e.RunTranslators = true
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if shadow := readShadow(t, e); !strings.Contains(shadow, "if !(a && b) {") {
+		t.Errorf("command translator output not used, got:\n%s", shadow)
+	}
+}
+
+func TestEngine_DSLCommandTranslatorOptIn(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		".inco.json": `{"translators": {"words": ["./words.sh"]}}`,
+		"words.sh":   "#!/bin/sh\nsed 's/ and / \\&\\& /g'\n",
+		"main.go": `package main
+
+func F(a, b bool) {
+	// @inco: -dsl(words) a and b
+	_ = a
+}
+`,
+	})
+	if err := os.Chmod(filepath.Join(dir, "words.sh"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	e := NewEngine(dir)
+	if err := e.Run(); err == nil || !strings.Contains(err.Error(), "--allow-translators") {
+		t.Fatalf("Run() error = %v, want the command refused without opt-in", err)
+	}
+
+	// Run from another directory: the relative command is found in the root.
+	t.Chdir(t.TempDir())
+	t.Setenv(allowTranslatorsEnv, "1")
+	e = NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if shadow := readShadow(t, e); !strings.Contains(shadow, "if !(a && b) {") {
+		t.Errorf("command translator output not used, got:\n%s", shadow)
+	}
+
+	// A new translator, same argv: the configuration hash changes.
+	hash := e.Config.hash(dir)
+	writeFile(t, filepath.Join(dir, "words.sh"), "#!/bin/sh\nsed 's/ and / || /g'\n")
+	if e.Config.hash(dir) == hash {
+		t.Error("config hash should change with the translator executable")
+	}
+	e = NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if shadow := readShadow(t, e); !strings.Contains(shadow, "if !(a || b) {") {
+		t.Errorf("shadow should be regenerated with the new translator, got:\n%s", shadow)
+	}
+}
+
+func TestEngine_DSLErrors(t *testing.T) {
+	src := map[string]string{
+		"main.go": `package main
+
+func F(a int) {
+	// @inco: -dsl(rule) a ok
+	_ = a
+}
+`,
+	}
+	tests := []struct {
+		name  string
+		trans map[string]Translator
+		want  string
+	}{
+		{"unregistered", nil, "no translator registered for -dsl(rule)"},
+		{"failing", map[string]Translator{"rule": func(string) (string, error) { return "", errors.New("boom") }}, "boom"},
+		{"not go", map[string]Translator{"rule": func(string) (string, error) { return "a ok", nil }}, "is not a Go expression"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEngine(setupDir(t, src))
+			e.Translators = tt.trans
+			err := e.Run()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Run() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
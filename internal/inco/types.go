@@ -14,6 +14,11 @@
 // The default action is -panic with an auto-generated message.
 package inco
 
+import (
+	"fmt"
+	"time"
+)
+
 // ---------------------------------------------------------------------------
 // Action
 // ---------------------------------------------------------------------------
@@ -28,6 +33,9 @@ const (
 	ActionBreak                      // break enclosing loop
 	ActionDo                         // execute arbitrary statement
 	ActionLog                        // log.Println(...)
+	ActionSlog                       // slog.Error("inco violation", attrs...)
+	ActionWarn                       // slog.Warn("inco violation", attrs...); never alters control flow
+	ActionMetric                     // only count the violation (-metric without an action)
 )
 
 var actionNames = map[ActionKind]string{
@@ -37,6 +45,14 @@ var actionNames = map[ActionKind]string{
 	ActionBreak:    "break",
 	ActionDo:       "do",
 	ActionLog:      "log",
+	ActionSlog:     "slog",
+	ActionWarn:     "warn",
+	ActionMetric:   "metric",
+}
+
+// structured reports whether the action logs a structured slog record.
+func (k ActionKind) structured() bool {
+	return k == ActionSlog || k == ActionWarn
 }
 
 func (k ActionKind) String() string {
@@ -52,11 +68,36 @@ func (k ActionKind) String() string {
 
 // Directive is the parsed form of a single @inco: comment.
 type Directive struct {
-	Action     ActionKind // panic (default), return, continue, break, do, log
-	ActionArgs []string   // e.g. -panic("msg") → ['"msg"'], -return(0, err) → ["0", "err"]
-	Expr       string     // the Go boolean expression
+	Action     ActionKind   // panic (default), return, continue, break, do, log
+	ActionArgs []string     // e.g. -panic("msg") → ['"msg"'], -return(0, err) → ["0", "err"]
+	Expr       string       // the Go boolean expression
+	Flag       string       // condition flag that produced Expr (e.g. "oneof"); empty for plain expressions
+	Desc       string       // human-readable condition for default messages; empty means Expr
+	FlagArgs   []string     // raw flag arguments, for flags the engine resolves (e.g. -is)
+	FlagVars   []string     // variables the flag applies to
+	Each       []*Directive // per-variable checks, when a flag carries per-variable messages
+	Msgf       []string     // -msgf format and arguments, replacing the default message
+	Wrap       string       // -wrap context string literal; the error is wrapped with fmt.Errorf
+	Except     []string     // -except sentinel errors tolerated via errors.Is
+	Retry      []string     // -retry attempt count and optional backoff duration
+	Call       string       // -call handler invoked with the violation before the action
+	Metric     string       // -metric counter name literal, incremented before the action
+	Sample     string       // -sample rate: fraction of executions that evaluate the condition
+	LogOnce    bool         // -logonce: log only the first violation at this site
+	LogEvery   string       // -logevery(N): log the first of every N violations at this site
+	Groups     []string     // contract groups from @inco[group, ...]:; generated only when one is enabled
+	Ensure     string       // EnsureAlways, EnsureOnSuccess or EnsureOnError for postconditions
 }
 
+// Postcondition modes (Directive.Ensure). A postcondition is checked when
+// the enclosing function returns; the conditional forms only when its
+// error result is nil or non-nil, respectively.
+const (
+	EnsureAlways    = "ensure"
+	EnsureOnSuccess = "onsuccess"
+	EnsureOnError   = "onerror"
+)
+
 // ---------------------------------------------------------------------------
 // Engine types
 // ---------------------------------------------------------------------------
@@ -66,14 +107,90 @@ type Overlay struct {
 	Replace map[string]string `json:"Replace"`
 }
 
+// RunStats summarizes the outcome of Engine.Run.
+type RunStats struct {
+	Mapped    int // source files in the overlay
+	Processed int // shadows generated in this run
+	Cached    int // shadows reused from a previous run
+}
+
 // Manifest tracks source file hashes for incremental generation.
 // Stored as .inco_cache/manifest.json.
 type Manifest struct {
-	Files map[string]ManifestEntry `json:"files"`
+	ConfigHash string                   `json:"config_hash,omitempty"` // fingerprint of the Config used for generation
+	Files      map[string]ManifestEntry `json:"files"`
 }
 
 // ManifestEntry records the state of a single source file at last gen.
 type ManifestEntry struct {
-	SrcHash    string `json:"src_hash"`    // SHA-256 hex of source content
-	ShadowPath string `json:"shadow_path"` // absolute path to shadow file
+	SrcHash    string         `json:"src_hash"`              // SHA-256 hex of source content
+	ShadowPath string         `json:"shadow_path"`           // absolute path to shadow file
+	ShadowHash string         `json:"shadow_hash,omitempty"` // SHA-256 hex of shadow content; shared shadows have equal hashes
+	Directives int            `json:"directives,omitempty"`  // directives injected into the shadow
+	Imports    []string       `json:"imports,omitempty"`     // import paths added by generation
+	Package    string         `json:"package,omitempty"`     // package name, for per-package generated files
+	Kinds      map[string]int `json:"kinds,omitempty"`       // directives injected, by kind (see Report.DirectivesByKind)
+	Warnings   []Diagnostic   `json:"warnings,omitempty"`    // generation warnings, repeated when the shadow is reused
+	Typed      bool           `json:"typed,omitempty"`       // generated from the package's types: regenerated on every run
+}
+
+// ShadowInfo summarizes the code injected into one shadow file.
+type ShadowInfo struct {
+	Directives int            // directives expanded into guards
+	Imports    []string       // import paths added to the file, sorted
+	Package    string         // package clause of the file
+	Kinds      map[string]int // Directives by kind (see Report.DirectivesByKind)
+	Warnings   []Diagnostic   // notes about directives left out, in line order
+	Contracts  []Contract     // the directives instrumented, in line order (see Engine.Contracts)
+	Typed      bool           // generated from the types of the package, not the file alone (see collectDiscarded)
+}
+
+// Diagnostic is a generation warning at a source position.
+type Diagnostic struct {
+	Path    string `json:"path"` // absolute path of the source file
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+// String formats d as "path:line: message".
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s:%d: %s", d.Path, d.Line, d.Message)
+}
+
+// FileEvent describes a file the engine has handled (see Engine.OnFileDone).
+type FileEvent struct {
+	Path    string
+	Info    ShadowInfo // what was injected; for cached files, as recorded by the run that generated the shadow
+	Cached  bool       // the shadow of a previous run was reused
+	Shared  bool       // the shadow was fetched from Engine.SharedCache
+	Skipped bool       // best-effort file that could not be parsed, a file over the limits, or a failed file; compiled as-is
+	Err     error      // why the file failed, with Engine.ContinueOnError
+}
+
+// Report describes the outcome of one run, for callers that render their
+// own summary (see Engine.RunReport).
+type Report struct {
+	RunStats
+	FilesScanned        int            // source files walked, after .incoignore and package filters
+	FilesWithDirectives int            // files with at least one directive injected
+	DirectivesByKind    map[string]int // KindRequire, KindMust, KindEnsure, or KindAnnotation for function annotations
+	ShadowsWritten      int            // shadow files written to .inco_cache; shared shadows count once
+	Shared              int            // shadows fetched from Engine.SharedCache instead of generated, among Processed
+	FilesFailed         int            // files skipped after an error, with Engine.ContinueOnError
+	Warnings            []Diagnostic   // in file and line order
+	Duration            time.Duration
+}
+
+// KindAnnotation is the Report.DirectivesByKind key of function
+// annotations such as @timing.
+const KindAnnotation = "annotation"
+
+// CompileEntry is one record of compile_db.json: a source file replaced
+// through the overlay and what generation injected into it. External
+// analyzers use it to account for code that exists only in the build.
+type CompileEntry struct {
+	File       string   `json:"file"`              // absolute source path
+	Shadow     string   `json:"shadow"`            // absolute shadow path
+	Directives int      `json:"directives"`        // injected guards
+	Imports    []string `json:"imports,omitempty"` // injected imports
 }
@@ -3,30 +3,57 @@
 package inco
 
 import (
+	"context"
+	"fmt"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
+	"strings"
 )
 
-// walkGoFiles walks root and calls fn for each non-test .go file that is
-// not excluded by skipDirRe or .incoignore. It handles directory skipping,
-// file filtering, and ignore-list matching in a single place so that
-// engine and audit share the same traversal logic.
+// walkGoFiles walks fsys, the tree under root, and calls fn with the path
+// under root of each .go file that is not excluded by skipDirRe,
+// .incoignore or filter; _test.go files only when filter.tests is set. It
+// handles directory skipping, file filtering, and ignore-list matching in
+// a single place so that engine and audit share the same traversal logic.
 //
 // Nested .incoignore files in subdirectories are supported: rules in a
 // child directory apply only to that subtree.
-func walkGoFiles(root string, fn func(path string) error) error {
-	ig := NewIgnoreTree(root)
+//
+// With filter.symlinks, symbolic links to directories are walked as if
+// they were the directories, under the link's path, so a module linked
+// into several services is instrumented in each. A link to a directory
+// the walk is already inside is skipped, which ends cycles.
+func walkGoFiles(fsys fs.FS, root string, filter pkgFilter, fn func(path string) error) error {
+	ig := newIgnoreTreeFS(root, fsys)
 
-	return filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+	var visit fs.WalkDirFunc
+	visit = func(name string, d fs.DirEntry, err error) error {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err == nil && filter.symlinks && d.Type()&fs.ModeSymlink != 0 {
+			if isDir, cycle := linkedDir(fsys, name); isDir {
+				_ = cycle // @inco: !cycle, -return(nil)
+				if !(!cycle) {
+					return nil
+				}
+				// The walk of the link starts at the directory it names,
+				// which the branch below handles like any other.
+				return fs.WalkDir(fsys, name, visit)
+			}
+		}
 //line /Users/hitomikirigiri/Desktop/imnive/inco/internal/inco/walk.inco.go:20
 		if !(err == nil) {
 			panic(err)
 		}
 //line /Users/hitomikirigiri/Desktop/imnive/inco/internal/inco/walk.inco.go:21
 		if d.IsDir() {
-			name := d.Name()
-			skip := skipDirRe.MatchString(name)
+			base := d.Name()
+			if name == "." {
+				base = filepath.Base(root)
+			}
+			skip := skipDirRe.MatchString(base)
 			_ = skip // @inco: !skip, -return(filepath.SkipDir)
 			if !(!skip) {
 				return filepath.SkipDir
@@ -40,9 +67,14 @@ func walkGoFiles(root string, fn func(path string) error) error {
 				return filepath.SkipDir
 			}
 //line /Users/hitomikirigiri/Desktop/imnive/inco/internal/inco/walk.inco.go:29
+			descend := filter.descend(relDir(root, path))
+			_ = descend // @inco: descend, -return(filepath.SkipDir)
+			if !(descend) {
+				return filepath.SkipDir
+			}
 			return nil
 		}
-		isGoSource := goSourceRe.MatchString(d.Name()) && !testFileRe.MatchString(d.Name())
+		isGoSource := goSourceRe.MatchString(d.Name()) && (filter.tests || !testFileRe.MatchString(d.Name()))
 		_ = isGoSource // @inco: isGoSource, -return(nil)
 		if !(isGoSource) {
 			return nil
@@ -53,21 +85,167 @@ func walkGoFiles(root string, fn func(path string) error) error {
 		if !(!ignored) {
 			return nil
 		}
+		selected := filter.match(relDir(root, filepath.Dir(path)))
+		_ = selected // @inco: selected, -return(nil)
+		if !(selected) {
+			return nil
+		}
 //line /Users/hitomikirigiri/Desktop/imnive/inco/internal/inco/walk.inco.go:35
 		return fn(path)
-	})
+	}
+	return fs.WalkDir(fsys, ".", visit)
+}
+
+// linkedDir reports whether the symbolic link name in fsys links to a
+// directory, and whether that directory is name's parent or one above it.
+// Cycles are only detected in file systems whose FileInfo os.SameFile
+// understands, such as os.DirFS.
+func linkedDir(fsys fs.FS, name string) (isDir, cycle bool) {
+	fi, err := fs.Stat(fsys, name)
+	if err != nil || !fi.IsDir() {
+		return false, false
+	}
+	for dir := path.Dir(name); ; dir = path.Dir(dir) {
+		if up, err := fs.Stat(fsys, dir); err == nil && os.SameFile(up, fi) {
+			return true, true
+		}
+		if dir == "." {
+			return true, false
+		}
+	}
 }
 
-// collectGoFiles returns all non-test .go file paths under root,
-// respecting skipDirRe and .incoignore. This is a convenience wrapper
-// around walkGoFiles for callers that need the full path list up front.
-func collectGoFiles(root string) []string {
+// collectGoFiles returns all .go file paths under root, read
+// from fsys, respecting skipDirRe, .incoignore and filter. This is a
+// convenience wrapper around walkGoFiles for callers that need the full
+// path list up front. The walk stops with ctx.Err() once ctx is done.
+func collectGoFiles(ctx context.Context, fsys fs.FS, root string, filter pkgFilter) ([]string, error) {
 	var paths []string
-	walkGoFiles(root, func(path string) error {
+	err := walkGoFiles(fsys, root, filter, func(path string) error {
 		paths = append(paths, path)
-		return nil
+		return ctx.Err()
 	})
-	return paths
+	return paths, err
+}
+
+// relDir returns dir relative to root, slash-separated, "." for the root.
+func relDir(root, dir string) string {
+	rel, err := filepath.Rel(root, dir)
+	_ = err // @inco: err == nil, -return(dir)
+	if !(err == nil) {
+		return dir
+	}
+	return filepath.ToSlash(rel)
+}
+
+// ---------------------------------------------------------------------------
+// Package filters
+// ---------------------------------------------------------------------------
+//
+// Config.Include and Config.Exclude select the packages to instrument with
+// go-style patterns relative to the root: "./api" is one directory,
+// "./api/..." the directory and everything below it. Unlike .incoignore,
+// which says what inco must never touch, they target one run at a subset
+// of the tree, e.g. a CI job per monorepo area.
+
+// pkgPattern is a parsed package pattern.
+type pkgPattern struct {
+	dir       string // slash-separated, relative to the root, "." for the root
+	recursive bool   // pattern ends in "/..."
+}
+
+// parsePkgPattern parses a package pattern such as "./api/...".
+func parsePkgPattern(p string) (pkgPattern, error) {
+	s := filepath.ToSlash(p)
+	recursive := s == "..." || strings.HasSuffix(s, "/...")
+	if recursive {
+		s = strings.TrimSuffix(strings.TrimSuffix(s, "..."), "/")
+	}
+	if s == "" {
+		s = "."
+	}
+	s = path.Clean(s)
+	valid := !strings.Contains(s, "...") && !path.IsAbs(s) && s != ".." && !strings.HasPrefix(s, "../")
+	_ = valid // @inco: valid, -return(pkgPattern{}, fmt.Errorf("invalid package pattern %q: want a directory under the root, optionally ending in /...", p))
+	if !(valid) {
+		return pkgPattern{}, fmt.Errorf("invalid package pattern %q: want a directory under the root, optionally ending in /...", p)
+	}
+	return pkgPattern{dir: s, recursive: recursive}, nil
+}
+
+// matches reports whether the pattern selects the package in dir.
+func (p pkgPattern) matches(dir string) bool {
+	if dir == p.dir {
+		return true
+	}
+	return p.recursive && (p.dir == "." || strings.HasPrefix(dir, p.dir+"/"))
+}
+
+// pkgFilter selects packages by include and exclude patterns. The zero
+// value selects every package, without its _test.go files, and does not
+// follow symbolic links.
+type pkgFilter struct {
+	include  []pkgPattern // empty: every package
+	exclude  []pkgPattern
+	tests    bool // select _test.go files too
+	symlinks bool // walk symbolic links to directories
+}
+
+// newPkgFilter parses include and exclude patterns.
+func newPkgFilter(include, exclude []string) (pkgFilter, error) {
+	var f pkgFilter
+	for _, list := range []struct {
+		patterns []string
+		out      *[]pkgPattern
+	}{{include, &f.include}, {exclude, &f.exclude}} {
+		for _, s := range list.patterns {
+			p, err := parsePkgPattern(s)
+			_ = err // @inco: err == nil, -return(pkgFilter{}, err)
+			if !(err == nil) {
+				return pkgFilter{}, err
+			}
+			*list.out = append(*list.out, p)
+		}
+	}
+	return f, nil
+}
+
+// match reports whether the package in dir is selected: matched by an
+// include pattern, if there are any, and by no exclude pattern.
+func (f pkgFilter) match(dir string) bool {
+	for _, p := range f.exclude {
+		if p.matches(dir) {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, p := range f.include {
+		if p.matches(dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// descend reports whether the walk must enter dir: it is not excluded with
+// its whole subtree, and it or a directory below it may be included.
+func (f pkgFilter) descend(dir string) bool {
+	for _, p := range f.exclude {
+		if p.recursive && p.matches(dir) {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, p := range f.include {
+		if p.matches(dir) || dir == "." || strings.HasPrefix(p.dir, dir+"/") {
+			return true
+		}
+	}
+	return false
 }
 
 // ---------------------------------------------------------------------------
@@ -0,0 +1,143 @@
+package inco
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// ---------------------------------------------------------------------------
+// Package filters
+// ---------------------------------------------------------------------------
+
+func TestPkgFilter(t *testing.T) {
+	f, err := newPkgFilter([]string{"./api/...", "cmd/server"}, []string{"./api/internal/perf/..."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		dir            string
+		match, descend bool
+	}{
+		{".", false, true},
+		{"api", true, true},
+		{"api/v1", true, true},
+		{"apix", false, false},
+		{"api/internal/perf", false, false},
+		{"api/internal/perf/x", false, false},
+		{"cmd", false, true},
+		{"cmd/server", true, true},
+		{"cmd/server/sub", false, false},
+		{"internal", false, false},
+	} {
+		if got := f.match(tc.dir); got != tc.match {
+			t.Errorf("match(%q) = %v, want %v", tc.dir, got, tc.match)
+		}
+		if got := f.descend(tc.dir); got != tc.descend {
+			t.Errorf("descend(%q) = %v, want %v", tc.dir, got, tc.descend)
+		}
+	}
+
+	var all pkgFilter
+	if !all.match("any/dir") || !all.descend("any/dir") {
+		t.Error("zero pkgFilter must select every package")
+	}
+}
+
+func TestParsePkgPattern_Invalid(t *testing.T) {
+	for _, p := range []string{"/abs/...", "../up", "./a/.../b", "a..."} {
+		if _, err := parsePkgPattern(p); err == nil {
+			t.Errorf("parsePkgPattern(%q): want error", p)
+		}
+	}
+}
+
+func TestLoadConfig_InvalidPattern(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		".inco.json": `{"exclude": ["../other"]}`,
+	})
+	if _, err := LoadConfig(dir); err == nil {
+		t.Fatal("want error for a pattern outside the root")
+	}
+}
+
+func TestEngine_IncludeExclude(t *testing.T) {
+	lib := "package %s\n\nfunc F(x int) {\n\t// @inco: x > 0\n}\n"
+	dir := setupDir(t, map[string]string{
+		"main.go":                "package main\n\nfunc main() {\n\t// @inco: true\n}\n",
+		"api/api.go":             fmt.Sprintf(lib, "api"),
+		"api/v1/v1.go":           fmt.Sprintf(lib, "v1"),
+		"api/internal/perf/p.go": fmt.Sprintf(lib, "perf"),
+		"store/store.go":         fmt.Sprintf(lib, "store"),
+	})
+	e := NewEngine(dir)
+	e.Config.Include = []string{"./api/..."}
+	e.Config.Exclude = []string{"./api/internal/perf/..."}
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for src := range e.Overlay.Replace {
+		rel, _ := filepath.Rel(dir, src)
+		got = append(got, filepath.ToSlash(rel))
+	}
+	sort.Strings(got)
+	if len(got) != 2 || got[0] != "api/api.go" || got[1] != "api/v1/v1.go" {
+		t.Fatalf("overlay = %v, want [api/api.go api/v1/v1.go]", got)
+	}
+
+	e.Config.Include = []string{"/abs"}
+	if err := e.Run(); err == nil {
+		t.Fatal("want error for an absolute pattern")
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Symbolic links
+// ---------------------------------------------------------------------------
+
+func TestEngine_FollowSymlinks(t *testing.T) {
+	dir := setupDir(t, map[string]string{
+		"shared/lib.go": "package lib\n\nfunc F(x int) {\n\t// @inco: x > 0\n}\n",
+	})
+	if err := os.MkdirAll(filepath.Join(dir, "svc/a"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "svc/b"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for link, target := range map[string]string{
+		"svc/a/lib":  "../../shared",
+		"svc/b/lib":  "../../shared",
+		"shared/up":  "..",  // a cycle
+		"svc/a/gone": "nil", // dangling
+	} {
+		if err := os.Symlink(target, filepath.Join(dir, link)); err != nil {
+			t.Skipf("symlinks: %v", err)
+		}
+	}
+
+	overlay := func(follow bool) []string {
+		e := NewEngine(dir)
+		e.Config.FollowSymlinks = follow
+		if err := e.Run(); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for src := range e.Overlay.Replace {
+			rel, _ := filepath.Rel(dir, src)
+			got = append(got, filepath.ToSlash(rel))
+		}
+		sort.Strings(got)
+		return got
+	}
+	if got := overlay(false); fmt.Sprint(got) != "[shared/lib.go]" {
+		t.Errorf("overlay = %v, want [shared/lib.go]", got)
+	}
+	want := "[shared/lib.go svc/a/lib/lib.go svc/b/lib/lib.go]"
+	if got := overlay(true); fmt.Sprint(got) != want {
+		t.Errorf("overlay with follow_symlinks = %v, want %s", got, want)
+	}
+}
@@ -0,0 +1,79 @@
+package inco
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWrap(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go toolchain not available")
+	}
+	dir := setupDir(t, map[string]string{
+		"go.mod": "module example.com/m\n\ngo 1.22\n",
+		"up/up.go": `package up
+
+import (
+	"errors"
+	stdio "io"
+)
+
+var ErrEmpty = errors.New("empty")
+
+type Node struct{ Name string }
+
+type node struct{}
+
+func Parse(src []byte, _ int) (*Node, error) { return &Node{}, nil }
+
+func Copy(w stdio.Writer, names ...string) {}
+
+func Map[T, U any](xs []T, f func(T) U) []U { return nil }
+
+func Hidden() *node { return nil }
+
+func (n *Node) Method() {}
+`,
+		".inco.contracts.json": `{"example.com/m/up": {"Parse": ["len(src) > 0, -return(nil, up.ErrEmpty)"]}}`,
+	})
+	src, err := Wrap(dir, "example.com/m/up")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(src)
+	for _, want := range []string{
+		"package up\n",
+		"\t\"example.com/m/up\"\n\tstdio \"io\"\n",
+		"// Not wrapped: Hidden: unexported type node\n",
+		"type Node = up.Node\n",
+		"func Parse(src []byte, p1 int) (*up.Node, error) {\n\t// @inco: len(src) > 0, -return(nil, up.ErrEmpty)\n\treturn up.Parse(src, p1)\n}",
+		"func Copy(w stdio.Writer, names ...string) {\n\tup.Copy(w, names...)\n}",
+		"func Map[T, U any](xs []T, f func(T) U) []U {\n\treturn up.Map[T, U](xs, f)\n}",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "Method") {
+		t.Errorf("methods should not be wrapped:\n%s", out)
+	}
+
+	// The wrapper builds, and so does its instrumented form.
+	writeFile(t, filepath.Join(dir, "wrapped", "up.go"), out)
+	e := NewEngine(dir)
+	if err := e.Run(); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("go", "build", "-overlay", e.OverlayPath(), "./...")
+	cmd.Dir = dir
+	if msg, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go build: %v\n%s", err, msg)
+	}
+
+	writeFile(t, filepath.Join(dir, ".inco.contracts.json"), `{"example.com/m/up": {"Parsee": ["true"]}}`)
+	if _, err := Wrap(dir, "example.com/m/up"); err == nil || !strings.Contains(err.Error(), "example.com/m/up.Parsee, which is not a wrapped function") {
+		t.Errorf("expected unknown function error, got %v", err)
+	}
+}